@@ -0,0 +1,108 @@
+package lcs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// annotateMaxBytes is the maximum number of raw bytes shown in a line of Annotate.
+const annotateMaxBytes = 16
+
+// Annotate decodes data into v, like Unmarshal, and returns an annotated hexdump of data.
+// See AnnotateWithOptions.
+func Annotate(data []byte, v interface{}) (string, error) {
+	return AnnotateWithOptions(data, v, DecoderOptions{})
+}
+
+// AnnotateWithOptions decodes data into v with the given options, and returns an annotated
+// hexdump of data. Every value has a line with its offset, raw bytes, path, Go type and
+// decoded value. Length prefixes, optional presence bytes, enum discriminants and map keys
+// have separate lines, labeled in parentheses.
+//
+// If data cannot be decoded, the hexdump up to the error is returned with the error.
+func AnnotateWithOptions(data []byte, v interface{}, opts DecoderOptions) (string, error) {
+	var spans []*walkSpan
+	w := newWalker(data, opts, true, func(s *walkSpan) error {
+		spans = append(spans, s)
+		return nil
+	})
+	err := w.walk(reflect.Indirect(reflect.ValueOf(v)).Type(), "", nil, nil, 0)
+	if err == nil {
+		err = UnmarshalWithOptions(data, v, opts)
+	}
+	sortSpans(spans)
+
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "offset\tbytes\tpath\ttype\tvalue")
+	for _, s := range spans {
+		var raw, value string
+		if s.leaf || s.label != "" {
+			raw = formatRaw(data[s.start:s.end])
+			value = formatValue(s.value)
+		}
+		path, depth := s.path, s.depth
+		if path == "" {
+			path = "."
+		}
+		if s.label != "" {
+			path += " (" + s.label + ")"
+		}
+		if s.label != "" && s.label != "key" {
+			// parts of a value are nested in it, unlike map keys which are beside values
+			depth++
+		}
+		fmt.Fprintf(tw, "%06x\t%s\t%s%s\t%s\t%s\n", s.start, raw, strings.Repeat("  ", depth), path, formatType(s.typ), value)
+	}
+	if err != nil {
+		fmt.Fprintf(tw, "%06x\t\terror: %s\t\t\n", w.sr.off, err)
+	}
+	tw.Flush()
+	return buf.String(), err
+}
+
+func formatRaw(b []byte) string {
+	if len(b) > annotateMaxBytes {
+		return hex.EncodeToString(b[:annotateMaxBytes-1]) + "..."
+	}
+	return hex.EncodeToString(b)
+}
+
+// formatType formats a type, except the fields of unnamed structs, which are shown on
+// their own lines.
+func formatType(t reflect.Type) string {
+	if t.Kind() == reflect.Struct && t.Name() == "" {
+		return "struct"
+	}
+	return t.String()
+}
+
+// formatValue formats a decoded value: strings are quoted, byte slices and arrays are
+// formatted in hex, and other values are formatted with fmt.
+func formatValue(v reflect.Value) string {
+	if !v.IsValid() {
+		return ""
+	}
+	switch {
+	case v.Kind() == reflect.String:
+		return strconv.Quote(v.String())
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		return "0x" + hex.EncodeToString(v.Bytes())
+	case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8:
+		b := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(b), v)
+		return "0x" + hex.EncodeToString(b)
+	}
+	if v.CanAddr() {
+		// such as big.Int, whose String method has a pointer receiver
+		if s, ok := v.Addr().Interface().(fmt.Stringer); ok {
+			return s.String()
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,131 @@
+package lcs
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+)
+
+func BenchmarkMarshalMap(b *testing.B) {
+	m := make(map[string][]byte)
+	for i := 0; i < 1000; i++ {
+		m[string([]byte{byte(i >> 8), byte(i)})] = make([]byte, 32)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type benchStruct struct {
+	Flag     bool
+	Small    uint8
+	Medium   uint32
+	Large    int64
+	Optional *uint64 `lcs:"optional"`
+	Name     string
+	Values   []uint16
+}
+
+var benchValue = &benchStruct{
+	Flag:   true,
+	Small:  1,
+	Medium: 0x12345678,
+	Large:  -1,
+	Name:   "hello",
+	Values: []uint16{1, 2, 3, 4, 5, 6, 7, 8},
+}
+
+func BenchmarkMarshalStruct(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(benchValue); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalStruct(b *testing.B) {
+	data, err := Marshal(benchValue)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		out := &benchStruct{}
+		if err := Unmarshal(data, out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecoderStream(b *testing.B) {
+	data, err := Marshal(benchValue)
+	if err != nil {
+		b.Fatal(err)
+	}
+	stream := bytes.Repeat(data, 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d := NewDecoder(bufio.NewReader(onlyReader{bytes.NewReader(stream)}))
+		for j := 0; j < 1000; j++ {
+			out := &benchStruct{}
+			if err := d.Decode(out); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// onlyReader hides all methods of the reader other than Read.
+type onlyReader struct {
+	r io.Reader
+}
+
+func (r onlyReader) Read(p []byte) (int, error) { return r.r.Read(p) }
+
+func BenchmarkUnmarshalUint64Slice(b *testing.B) {
+	data, err := Marshal(make([]uint64, 10000))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var out []uint64
+		if err := Unmarshal(data, &out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalUint64Slice(b *testing.B) {
+	v := make([]uint64, 10000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalStructReuse(b *testing.B) {
+	data, err := Marshal(benchValue)
+	if err != nil {
+		b.Fatal(err)
+	}
+	out := &benchStruct{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := UnmarshalWithOptions(data, out, DecoderOptions{Reuse: true}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
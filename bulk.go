@@ -0,0 +1,229 @@
+package lcs
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+)
+
+// isBulkElem returns whether slices and arrays of element type t can be encoded and decoded
+// in bulk, i.e. t is a fixed-width integer or bool without tag options or custom codec.
+func isBulkElem(t reflect.Type, elemTag *fieldTag, reg *Registry) bool {
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return false
+	}
+	if elemTag != nil {
+		return false
+	}
+	if _, ok := cEnumGetSize(t); ok {
+		return false
+	}
+	if _, ok := reg.codec(t); ok {
+		return false
+	}
+	if _, ok := reg.codec(reflect.PtrTo(t)); ok {
+		return false
+	}
+	return true
+}
+
+// encodeBulk writes the elements of rv, a string, or a slice or array of bulk elements.
+func (e *Encoder) encodeBulk(rv reflect.Value) (err error) {
+	switch rv.Kind() {
+	case reflect.String:
+		_, err = io.WriteString(e.w, rv.String())
+		return
+	case reflect.Array:
+		if !rv.CanAddr() {
+			return e.encodeBulkSlow(rv)
+		}
+		rv = rv.Slice(0, rv.Len())
+	}
+	b := e.scratch[:]
+	switch v := rv.Interface().(type) {
+	case []byte:
+		_, err = e.w.Write(v)
+	case []int8:
+		for _, x := range v {
+			if err = e.w.WriteByte(byte(x)); err != nil {
+				return
+			}
+		}
+	case []bool:
+		for _, x := range v {
+			if err = e.writeBool(x); err != nil {
+				return
+			}
+		}
+	case []uint16:
+		for _, x := range v {
+			binary.LittleEndian.PutUint16(b, x)
+			if _, err = e.w.Write(b[:2]); err != nil {
+				return
+			}
+		}
+	case []int16:
+		for _, x := range v {
+			binary.LittleEndian.PutUint16(b, uint16(x))
+			if _, err = e.w.Write(b[:2]); err != nil {
+				return
+			}
+		}
+	case []uint32:
+		for _, x := range v {
+			binary.LittleEndian.PutUint32(b, x)
+			if _, err = e.w.Write(b[:4]); err != nil {
+				return
+			}
+		}
+	case []int32:
+		for _, x := range v {
+			binary.LittleEndian.PutUint32(b, uint32(x))
+			if _, err = e.w.Write(b[:4]); err != nil {
+				return
+			}
+		}
+	case []uint64:
+		for _, x := range v {
+			binary.LittleEndian.PutUint64(b, x)
+			if _, err = e.w.Write(b[:8]); err != nil {
+				return
+			}
+		}
+	case []int64:
+		for _, x := range v {
+			binary.LittleEndian.PutUint64(b, uint64(x))
+			if _, err = e.w.Write(b[:8]); err != nil {
+				return
+			}
+		}
+	default:
+		return e.encodeBulkSlow(rv)
+	}
+	return
+}
+
+// encodeBulkSlow writes bulk elements of named types, or of unaddressable arrays.
+func (e *Encoder) encodeBulkSlow(rv reflect.Value) (err error) {
+	size := int(rv.Type().Elem().Size())
+	for i := 0; i < rv.Len(); i++ {
+		item := rv.Index(i)
+		switch {
+		case item.Kind() == reflect.Bool:
+			err = e.writeBool(item.Bool())
+		case isSignedKind(item.Kind()):
+			err = e.writeUint(uint64(item.Int()), size)
+		default:
+			err = e.writeUint(item.Uint(), size)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// decodeBulk reads the elements of rv, a slice of bulk elements with the final length.
+// decodeBulkChunks decodes a slice of type t with l bulk elements from a stream. The slice
+// grows a chunk at a time, so that a corrupt length fails at the end of the input instead of
+// allocating a huge slice first.
+func (d *Decoder) decodeBulkChunks(t reflect.Type, l int) (reflect.Value, error) {
+	chunk := bulkChunkSize / int(t.Elem().Size())
+	if chunk > l {
+		chunk = l
+	}
+	zeros := reflect.MakeSlice(t, chunk, chunk)
+	s := reflect.MakeSlice(t, 0, chunk)
+	for s.Len() < l {
+		start, n := s.Len(), chunk
+		if n > l-start {
+			n = l - start
+		}
+		s = reflect.AppendSlice(s, zeros.Slice(0, n))
+		if err := d.decodeBulk(s.Slice(start, start+n)); err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+func (d *Decoder) decodeBulk(rv reflect.Value) (err error) {
+	size := int(rv.Type().Elem().Size())
+	n := rv.Len() * size
+	var b []byte
+	if sr, ok := d.r.(*sliceReader); ok {
+		if b, err = sr.next(n); err != nil {
+			return
+		}
+	} else {
+		b = make([]byte, n)
+		if _, err = io.ReadFull(d.r, b); err != nil {
+			return
+		}
+	}
+	switch v := rv.Interface().(type) {
+	case []byte:
+		copy(v, b)
+	case []int8:
+		for i := range v {
+			v[i] = int8(b[i])
+		}
+	case []bool:
+		for i := range v {
+			if b[i] > 1 {
+				return errors.New("unexpected value for bool")
+			}
+			v[i] = b[i] == 1
+		}
+	case []uint16:
+		for i := range v {
+			v[i] = binary.LittleEndian.Uint16(b[2*i:])
+		}
+	case []int16:
+		for i := range v {
+			v[i] = int16(binary.LittleEndian.Uint16(b[2*i:]))
+		}
+	case []uint32:
+		for i := range v {
+			v[i] = binary.LittleEndian.Uint32(b[4*i:])
+		}
+	case []int32:
+		for i := range v {
+			v[i] = int32(binary.LittleEndian.Uint32(b[4*i:]))
+		}
+	case []uint64:
+		for i := range v {
+			v[i] = binary.LittleEndian.Uint64(b[8*i:])
+		}
+	case []int64:
+		for i := range v {
+			v[i] = int64(binary.LittleEndian.Uint64(b[8*i:]))
+		}
+	default:
+		for i := 0; i < rv.Len(); i++ {
+			item := rv.Index(i)
+			var u uint64
+			for j := size - 1; j >= 0; j-- {
+				u = u<<8 | uint64(b[i*size+j])
+			}
+			switch {
+			case item.Kind() == reflect.Bool:
+				if u > 1 {
+					return errors.New("unexpected value for bool")
+				}
+				item.SetBool(u == 1)
+			case isSignedKind(item.Kind()):
+				shift := uint(64 - 8*size)
+				item.SetInt(int64(u<<shift) >> shift)
+			default:
+				item.SetUint(u)
+			}
+		}
+	}
+	return nil
+}
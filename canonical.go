@@ -0,0 +1,70 @@
+package lcs
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// CanonicalError is returned by VerifyCanonical when data is not the canonical encoding of
+// the value it decodes to.
+type CanonicalError struct {
+	// Offset is the first offset at which data differs from the canonical encoding.
+	Offset int
+	// Path is the path of the innermost value at Offset, which is empty for the root value.
+	Path string
+	// Label is the part of the value at Offset: "len", "optional", "variant" or "key", or
+	// empty if it is the value itself.
+	Label string
+}
+
+func (e *CanonicalError) Error() string {
+	where := "root value"
+	if e.Path != "" {
+		where = e.Path
+	}
+	if e.Label != "" {
+		where = e.Label + " of " + where
+	}
+	return fmt.Sprintf("non-canonical encoding at offset %d, in %s", e.Offset, where)
+}
+
+// VerifyCanonical decodes data into v, and verifies that encoding v reproduces data exactly.
+// Otherwise, different data could decode to the same value, which matters when the value
+// is signed or hashed. See VerifyCanonicalWithOptions.
+func VerifyCanonical(data []byte, v interface{}) error {
+	return VerifyCanonicalWithOptions(data, v, DecoderOptions{})
+}
+
+// VerifyCanonicalWithOptions decodes data into v with the given options, and verifies that
+// encoding v with the same registry reproduces data exactly. On mismatch, it returns a
+// *CanonicalError locating the first differing byte.
+func VerifyCanonicalWithOptions(data []byte, v interface{}, opts DecoderOptions) error {
+	if err := UnmarshalWithOptions(data, v, opts); err != nil {
+		return err
+	}
+	b, err := MarshalWithOptions(v, EncoderOptions{Registry: opts.Registry})
+	if err != nil {
+		return err
+	}
+	off := 0
+	for off < len(data) && off < len(b) && data[off] == b[off] {
+		off++
+	}
+	if off == len(data) && off == len(b) {
+		return nil
+	}
+	cerr := &CanonicalError{Offset: off}
+	var best *walkSpan
+	w := newWalker(data, opts, false, func(s *walkSpan) error {
+		if s.start <= off && off < s.end && (best == nil || s.end-s.start < best.end-best.start) {
+			best = s
+		}
+		return nil
+	})
+	// data is already decoded, so the walk does not fail
+	w.walk(reflect.Indirect(reflect.ValueOf(v)).Type(), "", nil, nil, 0)
+	if best != nil {
+		cerr.Path, cerr.Label = best.path, best.label
+	}
+	return cerr
+}
@@ -0,0 +1,293 @@
+package lcs
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// CheckError lists the problems of a type found by Check.
+type CheckError struct {
+	Type reflect.Type
+	// Problems are the problems found, each prefixed with the path of the value, such as
+	// "Payments[].Amount: ...". In paths, "[]" is an element of a slice or array, or a value
+	// of a map, "[key]" is a key of a map, and "(T)" is the variant T of an enum.
+	Problems []string
+}
+
+func (e *CheckError) Error() string {
+	return fmt.Sprintf("type %s cannot be encoded: %s", e.Type, strings.Join(e.Problems, "; "))
+}
+
+// Check verifies that values of type t can be encoded and decoded, with the codecs in
+// DefaultRegistry. See CheckWithRegistry.
+func Check(t reflect.Type) error {
+	return CheckWithRegistry(t, DefaultRegistry)
+}
+
+// CheckWithRegistry verifies that values of type t can be encoded and decoded, with the
+// codecs in r. Call it from init or tests, so that problems are found before encoding.
+//
+// t and all the types reachable from it are checked, including the variants of enums. The
+// problems found are unsupported kinds, interfaces which are not registered enums, enum tags
+// whose structs do not implement EnumTypeUser, invalid len values, tags on types which
+// cannot use them, and unknown tag options, which are otherwise ignored. All the problems
+// are returned in a *CheckError.
+func CheckWithRegistry(t reflect.Type, r *Registry) error {
+	if t == nil {
+		return errors.New("nil type")
+	}
+	if r == nil {
+		r = DefaultRegistry
+	}
+	c := &checker{r: r, active: make(map[reflect.Type]bool), structs: make(map[reflect.Type]bool)}
+	c.check(t, "", nil, nil)
+	if len(c.problems) > 0 {
+		return &CheckError{Type: t, Problems: c.problems}
+	}
+	return nil
+}
+
+// MustCheck is like Check, but panics if the type has problems.
+func MustCheck(t reflect.Type) {
+	if err := Check(t); err != nil {
+		panic(err)
+	}
+}
+
+type checker struct {
+	r *Registry
+	// active are the types being checked, and structs are the structs checked
+	active   map[reflect.Type]bool
+	structs  map[reflect.Type]bool
+	problems []string
+}
+
+func (c *checker) addf(path string, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if path != "" {
+		msg = path + ": " + msg
+	}
+	c.problems = append(c.problems, msg)
+}
+
+// check checks type t at path, with the variants of the enum tag if there is one, and the
+// tag which applies to t.
+func (c *checker) check(t reflect.Type, path string, enumVariants map[EnumKeyType]reflect.Type, tag *fieldTag) {
+	if tag == nil && enumVariants == nil {
+		// a recursive type, such as type List []List, is checked once
+		if c.active[t] {
+			return
+		}
+		c.active[t] = true
+		defer delete(c.active, t)
+	}
+	if tag != nil && tag.optional {
+		if !tag.isOptional(t.Kind()) {
+			c.addf(path, "optional tag on %s, which cannot be nil", t)
+		}
+		tag = tag.withoutOptional()
+	}
+	if _, ok := c.r.codec(t); ok {
+		return
+	}
+	if _, ok := c.r.codec(reflect.PtrTo(t)); ok {
+		return
+	}
+	if tag != nil && tag.enum != "" {
+		enumVariants = c.enumVariants(path, tag)
+	}
+	if t.Kind() == reflect.Ptr {
+		c.check(t.Elem(), path, enumVariants, tag)
+		return
+	}
+
+	// the tags used by t, which are checked to be unused otherwise
+	usesLen, usesElem, usesKeyValue, usesEnum := false, false, false, false
+	if _, ok := cEnumGetSize(t); ok {
+		// encoded as a discriminant, whatever its integer kind
+		if tag != nil && tag.uleb128 {
+			c.addf(path, "uleb128 tag on C-style enum %s, which is encoded as a discriminant", t)
+		} else if tag != nil && tag.width != "" {
+			c.addf(path, "%s tag on C-style enum %s, which is encoded as a discriminant", tag.width, t)
+		}
+	} else if tag != nil && tag.uleb128 {
+		if !isUnsignedKind(t.Kind()) {
+			c.addf(path, "uleb128 tag requires unsigned integer, got %s", t.Kind())
+		}
+	} else if tag != nil && tag.width != "" {
+		if !isIntegerKind(t.Kind()) {
+			c.addf(path, "%s tag requires integer, got %s", tag.width, t.Kind())
+		}
+	} else if tag != nil && tag.isSet {
+		if t.Kind() != reflect.Slice {
+			c.addf(path, "set tag requires slice, got %s", t.Kind())
+		} else {
+			c.check(t.Elem(), path+"[]", enumVariants, tag.scope("elem", false))
+		}
+		usesElem, usesEnum = true, true
+	} else if tag != nil && tag.isMap {
+		c.checkEntries(t, path)
+		usesKeyValue = true
+	} else {
+		usesLen, usesElem, usesKeyValue, usesEnum = c.checkKind(t, path, enumVariants, tag)
+	}
+
+	if tag == nil {
+		return
+	}
+	if tag.hasLen && !usesLen {
+		c.addf(path, "len tag on %s, which is not a slice, array or string", t)
+	}
+	if tag.elem != nil && !usesElem {
+		c.addf(path, "elem tag options on %s, which is not a slice or array", t)
+	}
+	if (tag.key != nil || tag.value != nil) && !usesKeyValue {
+		c.addf(path, "key or value tag options on %s, which is not a map", t)
+	}
+	if tag.enum != "" && !usesEnum {
+		c.addf(path, "enum tag on %s, which is not an interface", t)
+	}
+}
+
+// checkKind checks t by its kind, and returns which tags it uses.
+func (c *checker) checkKind(t reflect.Type, path string, enumVariants map[EnumKeyType]reflect.Type, tag *fieldTag) (usesLen, usesElem, usesKeyValue, usesEnum bool) {
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	case reflect.Slice, reflect.Array, reflect.String:
+		if tag != nil && tag.hasLen {
+			if tag.fixedLen <= 0 {
+				c.addf(path, "len should be positive, got %d", tag.fixedLen)
+			} else if t.Kind() == reflect.Array && tag.fixedLen != t.Len() {
+				c.addf(path, "len %d differs from the array length %d", tag.fixedLen, t.Len())
+			}
+		}
+		if t.Kind() != reflect.String {
+			c.check(t.Elem(), path+"[]", enumVariants, tag.scope("elem", false))
+			return true, true, false, true
+		}
+		return true, false, false, false
+	case reflect.Struct:
+		// tags do not apply to the fields, so each struct is checked once
+		if !c.structs[t] {
+			c.structs[t] = true
+			c.checkStruct(t, path)
+		}
+	case reflect.Map:
+		c.check(t.Key(), path+"[key]", nil, tag.scope("key", false))
+		c.check(t.Elem(), path+"[]", nil, tag.scope("value", false))
+		return false, false, true, false
+	case reflect.Interface:
+		c.checkInterface(t, path, enumVariants)
+		return false, false, false, true
+	case reflect.Int, reflect.Uint, reflect.Uintptr:
+		c.addf(path, "%v", errMissingWidthTag(t.Kind()))
+	default:
+		c.addf(path, "not supported kind: %s", t.Kind())
+	}
+	return
+}
+
+func (c *checker) checkStruct(t reflect.Type, path string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Tag.Get(lcsTagName) == "-" {
+			continue
+		}
+		fpath := f.Name
+		if path != "" {
+			fpath = path + "." + f.Name
+		}
+		tag, err := newFieldTag(t, f.Tag.Get(lcsTagName))
+		if err != nil {
+			c.addf(fpath, "%v", err)
+			continue
+		}
+		c.checkUnknown(fpath, tag)
+		c.check(f.Type, fpath, nil, tag)
+	}
+}
+
+func (c *checker) checkUnknown(path string, tag *fieldTag) {
+	if tag == nil {
+		return
+	}
+	for _, name := range tag.unknown {
+		c.addf(path, "unknown tag option %q", name)
+	}
+}
+
+// checkEntries checks t, a slice with the map tag, whose elements are key-value structs.
+func (c *checker) checkEntries(t reflect.Type, path string) {
+	if t.Kind() != reflect.Slice {
+		c.addf(path, "map tag requires slice, got %s", t.Kind())
+		return
+	}
+	rt := t.Elem()
+	ki, vi, err := mapEntryFields(rt)
+	if err != nil {
+		c.addf(path, "%v", err)
+		return
+	}
+	for _, f := range []struct {
+		index int
+		path  string
+	}{{ki, path + "[key]"}, {vi, path + "[]"}} {
+		tag, err := newFieldTag(rt, rt.Field(f.index).Tag.Get(lcsTagName))
+		if err != nil {
+			c.addf(f.path, "%v", err)
+			continue
+		}
+		c.checkUnknown(f.path, tag)
+		c.check(rt.Field(f.index).Type, f.path, nil, tag)
+	}
+}
+
+func (c *checker) checkInterface(t reflect.Type, path string, enumVariants map[EnumKeyType]reflect.Type) {
+	variants, ok := regEnumIdxToType[t]
+	if !ok {
+		if enumVariants == nil {
+			c.addf(path, "interface %s is not a registered enum, and has no enum tag", t)
+			return
+		}
+		keys := make([]EnumKeyType, 0, len(enumVariants))
+		for k := range enumVariants {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		for _, k := range keys {
+			variants = append(variants, enumVariants[k])
+		}
+	}
+	for _, vt := range variants {
+		if vt == nil {
+			c.addf(path, "enum %s has a variant with nil template", t)
+			continue
+		}
+		if !vt.Implements(t) {
+			c.addf(path, "variant %s does not implement %s", vt, t)
+			continue
+		}
+		c.check(vt, path+"("+vt.String()+")", nil, nil)
+	}
+}
+
+// enumVariants returns the variants of the enum named in tag. If they are not defined, the
+// problem is reported, and an empty map is returned.
+func (c *checker) enumVariants(path string, tag *fieldTag) map[EnumKeyType]reflect.Type {
+	evsAll := enumVariantsByIdx(tag.owner)
+	if evsAll == nil {
+		c.addf(path, "struct %s does not implement EnumTypeUser", tag.owner)
+		return map[EnumKeyType]reflect.Type{}
+	}
+	evs, ok := evsAll[tag.enum]
+	if !ok {
+		c.addf(path, "enum variants not defined for enum name: %s", tag.enum)
+		return map[EnumKeyType]reflect.Type{}
+	}
+	return evs
+}
@@ -0,0 +1,133 @@
+// Command lcs inspects LCS encoded data.
+//
+// Usage:
+//
+//	lcs annotate -type TYPE [-x] [HEX]
+//	lcs diff -type TYPE [-x] FILE_A FILE_B
+//
+// The annotate subcommand prints an annotated hexdump of a value, with the offset, raw
+// bytes, path, type and decoded value of every field. The data is read from the HEX
+// argument, or from stdin, as hex text with -x or as raw bytes otherwise.
+//
+// The diff subcommand prints the paths and offsets of the values which differ between two
+// files, read as hex text with -x or as raw bytes otherwise.
+//
+// TYPE is a type expression such as
+//
+//	struct{sequence: u64, balances: map<string, u64>, auth: option<bytes>}
+//
+// made of bool, u8, u16, u32, u64, u128, i8, i16, i32, i64, string, bytes, vector<T>,
+// option<T>, map<K, V>, [T; N] and struct{name: T, ...}.
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/the729/lcs"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "annotate":
+		err = annotate(os.Args[2:], os.Stdin, os.Stdout)
+	case "diff":
+		err = diff(os.Args[2:], os.Stdout)
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "lcs:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: lcs annotate -type TYPE [-x] [HEX]")
+	fmt.Fprintln(os.Stderr, "       lcs diff -type TYPE [-x] FILE_A FILE_B")
+	os.Exit(2)
+}
+
+func annotate(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("annotate", flag.ExitOnError)
+	typ := fs.String("type", "", "type expression of the value")
+	hexInput := fs.Bool("x", false, "read stdin as hex text")
+	fs.Parse(args)
+	if *typ == "" {
+		return fmt.Errorf("missing -type")
+	}
+	t, err := parseType(*typ)
+	if err != nil {
+		return err
+	}
+	data, err := readInput(fs.Args(), *hexInput, stdin)
+	if err != nil {
+		return err
+	}
+	out, err := lcs.AnnotateWithOptions(data, reflect.New(t).Interface(), decoderOptions())
+	fmt.Fprint(stdout, out)
+	return err
+}
+
+func diff(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	typ := fs.String("type", "", "type expression of the values")
+	hexInput := fs.Bool("x", false, "read files as hex text")
+	fs.Parse(args)
+	if *typ == "" || fs.NArg() != 2 {
+		return fmt.Errorf("diff requires -type and two files")
+	}
+	t, err := parseType(*typ)
+	if err != nil {
+		return err
+	}
+	var data [2][]byte
+	for i, name := range fs.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		data[i], err = readInput(nil, *hexInput, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	diffs, err := lcs.DiffWithOptions(data[0], data[1], t, decoderOptions())
+	if err != nil {
+		return err
+	}
+	for _, d := range diffs {
+		fmt.Fprintln(stdout, d)
+	}
+	return nil
+}
+
+// readInput reads the data from the argument or stdin.
+func readInput(args []string, hexInput bool, stdin io.Reader) ([]byte, error) {
+	if len(args) > 0 {
+		return hex.DecodeString(strings.TrimPrefix(strings.Join(args, ""), "0x"))
+	}
+	b, err := ioutil.ReadAll(stdin)
+	if err != nil || !hexInput {
+		return b, err
+	}
+	return hex.DecodeString(strings.TrimPrefix(strings.Join(strings.Fields(string(b)), ""), "0x"))
+}
+
+// decoderOptions returns the options with the codecs of u128.
+func decoderOptions() lcs.DecoderOptions {
+	reg := lcs.NewRegistry()
+	reg.RegisterBigIntCodec(128)
+	return lcs.DecoderOptions{Registry: reg}
+}
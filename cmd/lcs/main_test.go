@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseType(t *testing.T) {
+	cases := []struct {
+		expr string
+		typ  string
+		err  string
+	}{
+		{expr: "u64", typ: "uint64"},
+		{expr: "vector<bytes>", typ: "[][]uint8"},
+		{expr: "map<string, u128>", typ: "map[string]*big.Int"},
+		{expr: "[u8; 16]", typ: "[16]uint8"},
+		{expr: "option<u32>", typ: `struct { Value *uint32 "lcs:\"optional\"" }`},
+		{
+			expr: "struct{a: vector<option<bool>>, b_c: map<u8, option<string>>}",
+			typ:  `struct { A []*bool "lcs:\"elem.optional\""; B_c map[uint8]*string "lcs:\"value.optional\"" }`,
+		},
+		{expr: "struct{}", typ: "struct {}"},
+		{expr: "option<option<u8>>", err: "nested option is not supported"},
+		{expr: "vector<u8", err: `type expression at 9: expected '>'`},
+		{expr: "u256", err: `unknown type "u256"`},
+		{expr: "struct{a: u8, a: u8}", err: "type expression at 19: duplicated field A"},
+		{expr: "[u8; 0]", err: "type expression at 6: invalid array length"},
+		{expr: "u8 u8", err: `type expression at 3: unexpected "u8"`},
+	}
+	for _, c := range cases {
+		typ, err := parseType(c.expr)
+		if c.err != "" {
+			assert.EqualError(t, err, c.err, c.expr)
+			continue
+		}
+		if assert.NoError(t, err, c.expr) {
+			assert.Equal(t, c.typ, typ.String(), c.expr)
+		}
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	var out bytes.Buffer
+	err := annotate([]string{"-type", "struct{seq: u64, auth: option<bytes>}", "-x"},
+		strings.NewReader("0700000000000000\n0102aabb\n"), &out)
+	assert.NoError(t, err)
+	assert.Equal(t, ""+
+		"offset  bytes             path                 type     value\n"+
+		"000000                    .                    struct   \n"+
+		"000000  0700000000000000    Seq                uint64   7\n"+
+		"000008  0102aabb            Auth               []uint8  0xaabb\n"+
+		"000008  01                    Auth (optional)  []uint8  true\n"+
+		"000009  02                    Auth (len)       []uint8  2\n", out.String())
+}
+
+func TestDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lcs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	assert.NoError(t, ioutil.WriteFile(a, []byte("0700000000000000 00"), 0644))
+	assert.NoError(t, ioutil.WriteFile(b, []byte("0800000000000000 0102aabb"), 0644))
+
+	var out bytes.Buffer
+	err = diff([]string{"-type", "struct{seq: u64, auth: option<bytes>}", "-x", a, b}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, ""+
+		"changed Seq at 0x0/0x0: 7 -> 8\n"+
+		"added Auth at 0x8/0x8\n", out.String())
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// typeParser parses type expressions into Go types at runtime, so that values can be
+// inspected without their Go definitions:
+//
+//	bool, u8, u16, u32, u64, u128, i8, i16, i32, i64, string, bytes
+//	vector<T>, option<T>, map<K, V>, [T; N], struct{name: T, ...}
+//
+// Struct field names are capitalized, since only exported fields are encoded.
+type typeParser struct {
+	s   string
+	pos int
+}
+
+// parsedType is a parsed type expression: a Go type, and the lcs tag options it needs,
+// relative to the value itself.
+type parsedType struct {
+	t    reflect.Type
+	opts []string
+}
+
+var primitiveTypes = map[string]reflect.Type{
+	"bool":   reflect.TypeOf(false),
+	"u8":     reflect.TypeOf(uint8(0)),
+	"u16":    reflect.TypeOf(uint16(0)),
+	"u32":    reflect.TypeOf(uint32(0)),
+	"u64":    reflect.TypeOf(uint64(0)),
+	"u128":   reflect.TypeOf((*big.Int)(nil)),
+	"i8":     reflect.TypeOf(int8(0)),
+	"i16":    reflect.TypeOf(int16(0)),
+	"i32":    reflect.TypeOf(int32(0)),
+	"i64":    reflect.TypeOf(int64(0)),
+	"string": reflect.TypeOf(""),
+	"bytes":  reflect.TypeOf([]byte(nil)),
+}
+
+// parseType parses a type expression. If the type needs tag options, it is wrapped in a
+// struct with a single field named Value.
+func parseType(s string) (reflect.Type, error) {
+	p := &typeParser{s: s}
+	pt, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	if len(pt.opts) == 0 {
+		return pt.t, nil
+	}
+	return reflect.StructOf([]reflect.StructField{pt.field("Value")}), nil
+}
+
+func (pt parsedType) field(name string) reflect.StructField {
+	f := reflect.StructField{Name: name, Type: pt.t}
+	if len(pt.opts) > 0 {
+		f.Tag = reflect.StructTag(`lcs:"` + strings.Join(pt.opts, ",") + `"`)
+	}
+	return f
+}
+
+func (p *typeParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("type expression at %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *typeParser) skipSpace() {
+	for p.pos < len(p.s) && unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+// ident returns the next identifier, or an empty string if there is none.
+func (p *typeParser) ident() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := rune(p.s[p.pos])
+		if c != '_' && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			break
+		}
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *typeParser) expect(c byte) error {
+	p.skipSpace()
+	if p.pos >= len(p.s) || p.s[p.pos] != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *typeParser) peek(c byte) bool {
+	p.skipSpace()
+	return p.pos < len(p.s) && p.s[p.pos] == c
+}
+
+func (p *typeParser) parse() (pt parsedType, err error) {
+	if p.peek('[') {
+		return p.parseArray()
+	}
+	name := p.ident()
+	if t, ok := primitiveTypes[name]; ok {
+		return parsedType{t: t}, nil
+	}
+	switch name {
+	case "vector", "option":
+		if err = p.expect('<'); err != nil {
+			return
+		}
+		var elem parsedType
+		if elem, err = p.parse(); err != nil {
+			return
+		}
+		if err = p.expect('>'); err != nil {
+			return
+		}
+		if name == "vector" {
+			return parsedType{t: reflect.SliceOf(elem.t), opts: scoped("elem", elem.opts)}, nil
+		}
+		for _, o := range elem.opts {
+			if o == "optional" {
+				return pt, errors.New("nested option is not supported")
+			}
+		}
+		pt = parsedType{t: elem.t, opts: append([]string{"optional"}, elem.opts...)}
+		switch elem.t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map:
+		default:
+			pt.t = reflect.PtrTo(elem.t)
+		}
+		return pt, nil
+	case "map":
+		var k, v parsedType
+		if err = p.expect('<'); err != nil {
+			return
+		}
+		if k, err = p.parse(); err != nil {
+			return
+		}
+		if err = p.expect(','); err != nil {
+			return
+		}
+		if v, err = p.parse(); err != nil {
+			return
+		}
+		if err = p.expect('>'); err != nil {
+			return
+		}
+		if !k.t.Comparable() {
+			return pt, fmt.Errorf("map key type %s is not comparable", k.t)
+		}
+		opts := append(scoped("key", k.opts), scoped("value", v.opts)...)
+		return parsedType{t: reflect.MapOf(k.t, v.t), opts: opts}, nil
+	case "struct":
+		return p.parseStruct()
+	case "":
+		return pt, p.errorf("expected type")
+	}
+	return pt, fmt.Errorf("unknown type %q", name)
+}
+
+func (p *typeParser) parseArray() (pt parsedType, err error) {
+	if err = p.expect('['); err != nil {
+		return
+	}
+	var elem parsedType
+	if elem, err = p.parse(); err != nil {
+		return
+	}
+	if err = p.expect(';'); err != nil {
+		return
+	}
+	n, err := strconv.Atoi(p.ident())
+	if err != nil || n <= 0 {
+		return pt, p.errorf("invalid array length")
+	}
+	if err = p.expect(']'); err != nil {
+		return
+	}
+	return parsedType{t: reflect.ArrayOf(n, elem.t), opts: scoped("elem", elem.opts)}, nil
+}
+
+func (p *typeParser) parseStruct() (pt parsedType, err error) {
+	if err = p.expect('{'); err != nil {
+		return
+	}
+	var fields []reflect.StructField
+	for !p.peek('}') {
+		if len(fields) > 0 {
+			if err = p.expect(','); err != nil {
+				return
+			}
+		}
+		name := p.ident()
+		if name == "" || unicode.IsDigit(rune(name[0])) {
+			return pt, p.errorf("expected field name")
+		}
+		if err = p.expect(':'); err != nil {
+			return
+		}
+		var ft parsedType
+		if ft, err = p.parse(); err != nil {
+			return
+		}
+		name = strings.ToUpper(name[:1]) + name[1:]
+		for _, f := range fields {
+			if f.Name == name {
+				return pt, p.errorf("duplicated field %s", name)
+			}
+		}
+		fields = append(fields, ft.field(name))
+	}
+	p.pos++
+	return parsedType{t: reflect.StructOf(fields)}, nil
+}
+
+// scoped returns tag options prefixed with a scope, such as "elem".
+func scoped(scope string, opts []string) []string {
+	r := make([]string, len(opts))
+	for i, o := range opts {
+		r[i] = scope + "." + o
+	}
+	return r
+}
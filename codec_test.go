@@ -1,621 +1,1347 @@
-package lcs
-
-import (
-	"encoding/hex"
-	"errors"
-	"reflect"
-	"strconv"
-	"strings"
-	"testing"
-
-	"github.com/stretchr/testify/assert"
-)
-
-type testCase struct {
-	v             interface{}
-	b             []byte
-	skipMarshal   bool
-	skipUnmarshal bool
-	errMarshal    error
-	errUnmarshal  error
-	name          string
-}
-
-func runTest(t *testing.T, cases []*testCase) {
-	var b []byte
-	var err error
-
-	for idx, c := range cases {
-		var name string
-		if c.name == "" {
-			name = strconv.Itoa(idx)
-		} else {
-			name = c.name
-		}
-		if !c.skipMarshal {
-			t.Run(name+"_marshal", func(t *testing.T) {
-				b, err = Marshal(c.v)
-				if c.errMarshal != nil {
-					assert.EqualError(t, err, c.errMarshal.Error())
-				} else {
-					assert.NoError(t, err)
-					assert.Equal(t, c.b, b)
-				}
-				// t.Logf("Case #%d(%s) marshal: Done", idx, c.name)
-			})
-		}
-		if !c.skipUnmarshal {
-			t.Run(name+"_unmarshal", func(t *testing.T) {
-				v := reflect.New(reflect.TypeOf(c.v))
-				err = Unmarshal(c.b, v.Interface())
-				if c.errUnmarshal != nil {
-					assert.EqualError(t, err, c.errUnmarshal.Error())
-				} else {
-					assert.NoError(t, err)
-					assert.Equal(t, c.v, v.Elem().Interface())
-				}
-				// t.Logf("Case #%d(%s) unmarshal: Done", idx, c.name)
-			})
-		}
-	}
-}
-
-func hexMustDecode(s string) []byte {
-	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
-	if err != nil {
-		panic(err)
-	}
-	return b
-}
-
-func TestBool(t *testing.T) {
-	vTrue := true
-	type Bool bool
-	vTrue2 := Bool(true)
-
-	runTest(t, []*testCase{
-		{
-			v:    bool(true),
-			b:    []byte{1},
-			name: "bool true",
-		},
-		{
-			v:    bool(false),
-			b:    []byte{0},
-			name: "bool false",
-		},
-		{
-			v:    &vTrue,
-			b:    []byte{1},
-			name: "ptr to bool",
-		},
-		{
-			v:    &vTrue2,
-			b:    []byte{1},
-			name: "ptr to alias of bool",
-		},
-	})
-}
-
-func TestInts(t *testing.T) {
-	runTest(t, []*testCase{
-		{
-			v:    int8(-1),
-			b:    []byte{0xFF},
-			name: "int8 neg",
-		},
-		{
-			v:    uint8(1),
-			b:    []byte{1},
-			name: "uint8 pos",
-		},
-		{
-			v:    int16(-4660),
-			b:    hexMustDecode("CCED"),
-			name: "int16 neg",
-		},
-		{
-			v:    uint16(4660),
-			b:    hexMustDecode("3412"),
-			name: "uint16 pos",
-		},
-		{
-			v:    int32(-305419896),
-			b:    hexMustDecode("88A9CBED"),
-			name: "int32 neg",
-		},
-		{
-			v:    uint32(305419896),
-			b:    hexMustDecode("78563412"),
-			name: "uint32 pos",
-		},
-		{
-			v:    int64(-1311768467750121216),
-			b:    hexMustDecode("0011325487A9CBED"),
-			name: "int64 neg",
-		},
-		{
-			v:    uint64(1311768467750121216),
-			b:    hexMustDecode("00EFCDAB78563412"),
-			name: "uint64 pos",
-		},
-	})
-}
-
-func TestBasicSlice(t *testing.T) {
-	runTest(t, []*testCase{
-		{
-			v:    []byte{0x11, 0x22, 0x33, 0x44, 0x55},
-			b:    hexMustDecode("05 11 22 33 44 55"),
-			name: "byte slice",
-		},
-		{
-			v:    []uint16{0x11, 0x22},
-			b:    hexMustDecode("02 1100 2200"),
-			name: "uint16 slice",
-		},
-		{
-			v:    make([]uint8, 130),
-			b:    hexMustDecode("8201 " + strings.Repeat("00", 130)),
-			name: "uint8 long slice",
-		},
-		{
-			v:    "ሰማይ አይታረስ ንጉሥ አይከሰስ።",
-			b:    hexMustDecode("36E188B0E1889BE18BAD20E18AA0E18BADE189B3E188A8E188B520E18A95E18C89E188A520E18AA0E18BADE18AA8E188B0E188B5E18DA2"),
-			name: "utf8 string",
-		},
-	})
-}
-
-func Test2DSlice(t *testing.T) {
-	runTest(t, []*testCase{
-		{
-			v:    [][]byte{{0x01, 0x02}, {0x11, 0x12, 0x13}, {0x21}},
-			b:    hexMustDecode("03 02 0102 03 111213 01 21"),
-			name: "2d byte slice",
-		},
-		{
-			v:    []string{"hello", "world"},
-			b:    hexMustDecode("02 05 68656c6c6f 05 776f726c64"),
-			name: "string slice",
-		},
-	})
-}
-
-func TestBasicStruct(t *testing.T) {
-	type MyStruct struct {
-		Boolean    bool
-		Bytes      []byte
-		Label      string
-		unexported uint32
-	}
-	type Wrapper struct {
-		Inner *MyStruct
-		Name  string
-	}
-
-	runTest(t, []*testCase{
-		{
-			v:    struct{}{},
-			b:    nil,
-			name: "empty struct",
-		},
-		{
-			v: MyStruct{
-				Boolean: true,
-				Bytes:   []byte{0x11, 0x22},
-				Label:   "hello",
-			},
-			b:    hexMustDecode("01 02 11 22 05 68656c6c6f"),
-			name: "struct with unexported fields",
-		},
-		{
-			v: &MyStruct{
-				Boolean: true,
-				Bytes:   []byte{0x11, 0x22},
-				Label:   "hello",
-			},
-			b:    hexMustDecode("01 02 11 22 05 68656c6c6f"),
-			name: "pointer to struct",
-		},
-		{
-			v: Wrapper{
-				Inner: &MyStruct{
-					Boolean: true,
-					Bytes:   []byte{0x11, 0x22},
-					Label:   "hello",
-				},
-				Name: "world",
-			},
-			b:    hexMustDecode("01 02 11 22 05 68656c6c6f 05 776f726c64"),
-			name: "nested struct",
-		},
-		{
-			v: &Wrapper{
-				Inner: &MyStruct{
-					Boolean: true,
-					Bytes:   []byte{0x11, 0x22},
-					Label:   "hello",
-				},
-				Name: "world",
-			},
-			b:    hexMustDecode("01 02 1122 05 68656c6c6f 05 776f726c64"),
-			name: "pointer to nested struct",
-		},
-	})
-}
-
-func TestStructWithFixedLenMember(t *testing.T) {
-	type MyStruct struct {
-		Str           string `lcs:"len=2"`
-		Bytes         []byte `lcs:"len=4"`
-		OptionalBytes []byte `lcs:"len=4,optional"`
-	}
-
-	runTest(t, []*testCase{
-		{
-			v: MyStruct{
-				Str:   "12",
-				Bytes: []byte{0x11, 0x22},
-			},
-			errMarshal:    errors.New("actual len not equal to fixed len"),
-			name:          "struct with wrong fixed len (bytes)",
-			skipUnmarshal: true,
-		},
-		{
-			v: MyStruct{
-				Str:   "",
-				Bytes: []byte{0x11, 0x22, 0x33, 0x44},
-			},
-			errMarshal:    errors.New("actual len not equal to fixed len"),
-			name:          "struct with wrong fixed len (string)",
-			skipUnmarshal: true,
-		},
-		{
-			v: MyStruct{
-				Str:   "12",
-				Bytes: []byte{0x11, 0x22, 0x33, 0x44},
-			},
-			b:    hexMustDecode("31 32 11223344 00"),
-			name: "struct with fixed len",
-		},
-		{
-			v: MyStruct{
-				Str:           "12",
-				Bytes:         []byte{0x11, 0x22, 0x33, 0x44},
-				OptionalBytes: []byte{0x55, 0x66, 0x77, 0x88},
-			},
-			b:    hexMustDecode("3132 11223344 01 55667788"),
-			name: "struct with optional fixed len",
-		},
-	})
-}
-
-func TestArray(t *testing.T) {
-	runTest(t, []*testCase{
-		{
-			v:    [4]byte{0x11, 0x22, 0x33, 0x44},
-			b:    hexMustDecode("11223344"),
-			name: "byte array",
-		},
-		{
-			v:    [2]uint32{0x11, 0x22},
-			b:    hexMustDecode("11000000 22000000"),
-			name: "uint32 array",
-		},
-	})
-}
-
-func TestRecursiveStruct(t *testing.T) {
-	type StructTag struct {
-		Address    []byte
-		Module     string
-		Name       string
-		TypeParams []*StructTag
-	}
-
-	runTest(t, []*testCase{
-		{
-			v: &StructTag{
-				Address:    []byte{0x11, 0x22},
-				Module:     "hello",
-				Name:       "world",
-				TypeParams: []*StructTag{},
-			},
-			b:    hexMustDecode("02 1122 05 68656c6c6f 05 776f726c64 00"),
-			name: "recursive struct",
-		},
-	})
-}
-
-func TestOptional(t *testing.T) {
-	type Wrapper struct {
-		Ignored int     `lcs:"-"`
-		Name    *string `lcs:"optional"`
-	}
-	hello := "hello"
-
-	type Wrapper2 struct {
-		Slice []byte `lcs:"optional"`
-	}
-	type Wrapper3 struct {
-		Map map[uint8]uint8 `lcs:"optional"`
-	}
-
-	runTest(t, []*testCase{
-		{
-			v: Wrapper{
-				Name: &hello,
-			},
-			b:    hexMustDecode("01 05 68656c6c6f"),
-			name: "struct with set optional fields",
-		},
-		{
-			v:    Wrapper{},
-			b:    hexMustDecode("00"),
-			name: "struct with unset optional fields",
-		},
-		{
-			v: Wrapper2{
-				Slice: []byte(hello),
-			},
-			b:    hexMustDecode("01 05 68656c6c6f"),
-			name: "struct with set optional slice",
-		},
-		{
-			v:    Wrapper2{},
-			b:    hexMustDecode("00"),
-			name: "struct with unset optional slice",
-		},
-		{
-			v: Wrapper3{
-				Map: map[uint8]uint8{1: 2},
-			},
-			b:    hexMustDecode("01 01 01 02"),
-			name: "struct with set optional map",
-		},
-		{
-			v:    Wrapper3{},
-			b:    hexMustDecode("00"),
-			name: "struct with unset optional map",
-		},
-	})
-}
-
-func TestMap(t *testing.T) {
-	runTest(t, []*testCase{
-		{
-			v:    map[uint8]string{1: "hello", 2: "world"},
-			b:    hexMustDecode("02 01 05 68656c6c6f 02 05 776f726c64"),
-			name: "map[uint8]string",
-		},
-		{
-			v:    map[string]uint8{"hello": 1, "world": 2},
-			b:    hexMustDecode("02 05 68656c6c6f 01 05 776f726c64 02"),
-			name: "map[string]uint8",
-		},
-	})
-}
-
-type Option0 struct {
-	Data uint32
-}
-type Option1 struct{}
-type Option2 bool
-type Option3 []byte
-type isOption interface {
-	isOption()
-}
-type Option struct {
-	Option isOption `lcs:"enum=option"`
-}
-type OptionalOption struct {
-	Option isOption `lcs:"optional,enum=option"`
-}
-
-func (*Option0) isOption() {}
-func (Option1) isOption()  {}
-func (Option2) isOption()  {}
-func (Option3) isOption()  {}
-
-var optionEnumDef = []EnumVariant{
-	{
-		Name:     "option",
-		Value:    0,
-		Template: (*Option0)(nil),
-	},
-	{
-		Name:     "option",
-		Value:    1,
-		Template: Option1{},
-	},
-	{
-		Name:     "option",
-		Value:    2,
-		Template: Option2(false),
-	},
-	{
-		Name:     "option",
-		Value:    3,
-		Template: Option3(nil),
-	},
-}
-
-func (*Option) EnumTypes() []EnumVariant         { return optionEnumDef }
-func (*OptionalOption) EnumTypes() []EnumVariant { return optionEnumDef }
-
-func TestEnum(t *testing.T) {
-	runTest(t, []*testCase{
-		{
-			v: &Option{
-				Option: &Option0{5},
-			},
-			b:    hexMustDecode("00 0500 0000"),
-			name: "ptr to struct with ptr enum variant",
-		},
-		{
-			v: &Option{
-				Option: Option1{},
-			},
-			b:    hexMustDecode("01"),
-			name: "ptr to struct with non-ptr empty variant",
-		},
-		{
-			v: &Option{
-				Option: Option2(true),
-			},
-			b:    hexMustDecode("02 01"),
-			name: "ptr to struct with real value as enum variant",
-		},
-		{
-			v: &Option{
-				Option: Option3([]byte{0x11, 0x22}),
-			},
-			b:    hexMustDecode("03 02 11 22"),
-			name: "ptr to struct with slice as enum variant",
-		},
-		{
-			v: &Option{
-				Option: Option3([]byte{}),
-			},
-			b:    hexMustDecode("03 00"),
-			name: "ptr to struct with nil slice as enum variant",
-		},
-		{
-			v: Option{
-				Option: Option1{},
-			},
-			b:    hexMustDecode("01"),
-			name: "non-ptr struct with variant",
-		},
-		{
-			v:    OptionalOption{},
-			name: "nil enum on optional field",
-			b:    hexMustDecode("00"),
-		},
-		{
-			v:             Option{},
-			name:          "nil variant on non-optional field",
-			skipUnmarshal: true,
-			errMarshal:    errors.New("non-optional enum value is nil"),
-		},
-	})
-}
-
-type OptionWrap struct {
-	OptionStruct    Option
-	OptionStructPtr *Option
-}
-
-func TestEnumInStruct(t *testing.T) {
-	runTest(t, []*testCase{
-		{
-			v: &OptionWrap{
-				OptionStruct: Option{
-					Option: Option3([]byte{0x11, 0x22}),
-				},
-				OptionStructPtr: &Option{
-					Option: Option1{},
-				},
-			},
-			b:    hexMustDecode("03 02 1122 01"),
-			name: "enum struct in struct",
-		},
-		{
-			v: &OptionWrap{
-				OptionStructPtr: &Option{
-					Option: Option3([]byte{0x11, 0x22}),
-				},
-				OptionStruct: Option{
-					Option: Option1{},
-				},
-			},
-			b:    hexMustDecode("01 03 02 1122"),
-			name: "enum struct in struct 2",
-		},
-	})
-}
-
-type OptionSlice struct {
-	Option []isOption `lcs:"enum=option"`
-}
-
-func (*OptionSlice) EnumTypes() []EnumVariant {
-	return []EnumVariant{
-		{
-			Name:     "option",
-			Value:    0,
-			Template: (*Option0)(nil),
-		},
-		{
-			Name:     "option",
-			Value:    1,
-			Template: Option1{},
-		},
-		{
-			Name:     "option",
-			Value:    2,
-			Template: Option2(false),
-		},
-	}
-}
-
-func TestEnumSlice(t *testing.T) {
-	runTest(t, []*testCase{
-		{
-			v: &OptionSlice{
-				Option: []isOption{
-					&Option0{5},
-					Option1{},
-					Option2(true),
-				},
-			},
-			b:    hexMustDecode("03 00 05000000 01 02 01"),
-			name: "enum slice",
-		},
-	})
-}
-
-type OptionSlice2D struct {
-	Option [][]isOption `lcs:"enum=option"`
-}
-
-func (*OptionSlice2D) EnumTypes() []EnumVariant {
-	return []EnumVariant{
-		{
-			Name:     "option",
-			Value:    0,
-			Template: (*Option0)(nil),
-		},
-		{
-			Name:     "option",
-			Value:    1,
-			Template: (*Option1)(nil),
-		},
-		{
-			Name:     "option",
-			Value:    2,
-			Template: Option2(false),
-		},
-	}
-}
-
-func TestEnum2DSlice(t *testing.T) {
-	runTest(t, []*testCase{
-		{
-			v: &OptionSlice2D{
-				Option: [][]isOption{
-					{
-						&Option0{5},
-						Option2(true),
-					},
-					{
-						Option2(false),
-					},
-				},
-			},
-			b:    hexMustDecode("02 02 00 05000000 02 01 01 02 00"),
-			name: "2D enum slice",
-		},
-	})
-}
+package lcs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCase struct {
+	v             interface{}
+	b             []byte
+	skipMarshal   bool
+	skipUnmarshal bool
+	errMarshal    error
+	errUnmarshal  error
+	name          string
+}
+
+func runTest(t *testing.T, cases []*testCase) {
+	var b []byte
+	var err error
+
+	for idx, c := range cases {
+		var name string
+		if c.name == "" {
+			name = strconv.Itoa(idx)
+		} else {
+			name = c.name
+		}
+		if !c.skipMarshal {
+			t.Run(name+"_marshal", func(t *testing.T) {
+				b, err = Marshal(c.v)
+				if c.errMarshal != nil {
+					assert.EqualError(t, err, c.errMarshal.Error())
+				} else {
+					assert.NoError(t, err)
+					assert.Equal(t, c.b, b)
+				}
+				// t.Logf("Case #%d(%s) marshal: Done", idx, c.name)
+			})
+		}
+		if !c.skipUnmarshal {
+			t.Run(name+"_unmarshal", func(t *testing.T) {
+				v := reflect.New(reflect.TypeOf(c.v))
+				err = Unmarshal(c.b, v.Interface())
+				if c.errUnmarshal != nil {
+					assert.EqualError(t, err, c.errUnmarshal.Error())
+				} else {
+					assert.NoError(t, err)
+					assert.Equal(t, c.v, v.Elem().Interface())
+				}
+				// t.Logf("Case #%d(%s) unmarshal: Done", idx, c.name)
+			})
+		}
+	}
+}
+
+func hexMustDecode(s string) []byte {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestBool(t *testing.T) {
+	vTrue := true
+	type Bool bool
+	vTrue2 := Bool(true)
+
+	runTest(t, []*testCase{
+		{
+			v:    bool(true),
+			b:    []byte{1},
+			name: "bool true",
+		},
+		{
+			v:    bool(false),
+			b:    []byte{0},
+			name: "bool false",
+		},
+		{
+			v:    &vTrue,
+			b:    []byte{1},
+			name: "ptr to bool",
+		},
+		{
+			v:    &vTrue2,
+			b:    []byte{1},
+			name: "ptr to alias of bool",
+		},
+	})
+}
+
+func TestInts(t *testing.T) {
+	runTest(t, []*testCase{
+		{
+			v:    int8(-1),
+			b:    []byte{0xFF},
+			name: "int8 neg",
+		},
+		{
+			v:    uint8(1),
+			b:    []byte{1},
+			name: "uint8 pos",
+		},
+		{
+			v:    int16(-4660),
+			b:    hexMustDecode("CCED"),
+			name: "int16 neg",
+		},
+		{
+			v:    uint16(4660),
+			b:    hexMustDecode("3412"),
+			name: "uint16 pos",
+		},
+		{
+			v:    int32(-305419896),
+			b:    hexMustDecode("88A9CBED"),
+			name: "int32 neg",
+		},
+		{
+			v:    uint32(305419896),
+			b:    hexMustDecode("78563412"),
+			name: "uint32 pos",
+		},
+		{
+			v:    int64(-1311768467750121216),
+			b:    hexMustDecode("0011325487A9CBED"),
+			name: "int64 neg",
+		},
+		{
+			v:    uint64(1311768467750121216),
+			b:    hexMustDecode("00EFCDAB78563412"),
+			name: "uint64 pos",
+		},
+	})
+}
+
+func TestBasicSlice(t *testing.T) {
+	runTest(t, []*testCase{
+		{
+			v:    []byte{0x11, 0x22, 0x33, 0x44, 0x55},
+			b:    hexMustDecode("05 11 22 33 44 55"),
+			name: "byte slice",
+		},
+		{
+			v:    []uint16{0x11, 0x22},
+			b:    hexMustDecode("02 1100 2200"),
+			name: "uint16 slice",
+		},
+		{
+			v:    make([]uint8, 130),
+			b:    hexMustDecode("8201 " + strings.Repeat("00", 130)),
+			name: "uint8 long slice",
+		},
+		{
+			v:    "ሰማይ አይታረስ ንጉሥ አይከሰስ።",
+			b:    hexMustDecode("36E188B0E1889BE18BAD20E18AA0E18BADE189B3E188A8E188B520E18A95E18C89E188A520E18AA0E18BADE18AA8E188B0E188B5E18DA2"),
+			name: "utf8 string",
+		},
+	})
+}
+
+func Test2DSlice(t *testing.T) {
+	runTest(t, []*testCase{
+		{
+			v:    [][]byte{{0x01, 0x02}, {0x11, 0x12, 0x13}, {0x21}},
+			b:    hexMustDecode("03 02 0102 03 111213 01 21"),
+			name: "2d byte slice",
+		},
+		{
+			v:    []string{"hello", "world"},
+			b:    hexMustDecode("02 05 68656c6c6f 05 776f726c64"),
+			name: "string slice",
+		},
+	})
+}
+
+func TestBasicStruct(t *testing.T) {
+	type MyStruct struct {
+		Boolean    bool
+		Bytes      []byte
+		Label      string
+		unexported uint32
+	}
+	type Wrapper struct {
+		Inner *MyStruct
+		Name  string
+	}
+
+	runTest(t, []*testCase{
+		{
+			v:    struct{}{},
+			b:    nil,
+			name: "empty struct",
+		},
+		{
+			v: MyStruct{
+				Boolean: true,
+				Bytes:   []byte{0x11, 0x22},
+				Label:   "hello",
+			},
+			b:    hexMustDecode("01 02 11 22 05 68656c6c6f"),
+			name: "struct with unexported fields",
+		},
+		{
+			v: &MyStruct{
+				Boolean: true,
+				Bytes:   []byte{0x11, 0x22},
+				Label:   "hello",
+			},
+			b:    hexMustDecode("01 02 11 22 05 68656c6c6f"),
+			name: "pointer to struct",
+		},
+		{
+			v: Wrapper{
+				Inner: &MyStruct{
+					Boolean: true,
+					Bytes:   []byte{0x11, 0x22},
+					Label:   "hello",
+				},
+				Name: "world",
+			},
+			b:    hexMustDecode("01 02 11 22 05 68656c6c6f 05 776f726c64"),
+			name: "nested struct",
+		},
+		{
+			v: &Wrapper{
+				Inner: &MyStruct{
+					Boolean: true,
+					Bytes:   []byte{0x11, 0x22},
+					Label:   "hello",
+				},
+				Name: "world",
+			},
+			b:    hexMustDecode("01 02 1122 05 68656c6c6f 05 776f726c64"),
+			name: "pointer to nested struct",
+		},
+	})
+}
+
+func TestStructWithFixedLenMember(t *testing.T) {
+	type MyStruct struct {
+		Str           string `lcs:"len=2"`
+		Bytes         []byte `lcs:"len=4"`
+		OptionalBytes []byte `lcs:"len=4,optional"`
+	}
+
+	runTest(t, []*testCase{
+		{
+			v: MyStruct{
+				Str:   "12",
+				Bytes: []byte{0x11, 0x22},
+			},
+			errMarshal:    errors.New("actual len not equal to fixed len"),
+			name:          "struct with wrong fixed len (bytes)",
+			skipUnmarshal: true,
+		},
+		{
+			v: MyStruct{
+				Str:   "",
+				Bytes: []byte{0x11, 0x22, 0x33, 0x44},
+			},
+			errMarshal:    errors.New("actual len not equal to fixed len"),
+			name:          "struct with wrong fixed len (string)",
+			skipUnmarshal: true,
+		},
+		{
+			v: MyStruct{
+				Str:   "12",
+				Bytes: []byte{0x11, 0x22, 0x33, 0x44},
+			},
+			b:    hexMustDecode("31 32 11223344 00"),
+			name: "struct with fixed len",
+		},
+		{
+			v: MyStruct{
+				Str:           "12",
+				Bytes:         []byte{0x11, 0x22, 0x33, 0x44},
+				OptionalBytes: []byte{0x55, 0x66, 0x77, 0x88},
+			},
+			b:    hexMustDecode("3132 11223344 01 55667788"),
+			name: "struct with optional fixed len",
+		},
+	})
+}
+
+func TestArray(t *testing.T) {
+	runTest(t, []*testCase{
+		{
+			v:    [4]byte{0x11, 0x22, 0x33, 0x44},
+			b:    hexMustDecode("11223344"),
+			name: "byte array",
+		},
+		{
+			v:    [2]uint32{0x11, 0x22},
+			b:    hexMustDecode("11000000 22000000"),
+			name: "uint32 array",
+		},
+	})
+}
+
+func TestRecursiveStruct(t *testing.T) {
+	type StructTag struct {
+		Address    []byte
+		Module     string
+		Name       string
+		TypeParams []*StructTag
+	}
+
+	runTest(t, []*testCase{
+		{
+			v: &StructTag{
+				Address:    []byte{0x11, 0x22},
+				Module:     "hello",
+				Name:       "world",
+				TypeParams: []*StructTag{},
+			},
+			b:    hexMustDecode("02 1122 05 68656c6c6f 05 776f726c64 00"),
+			name: "recursive struct",
+		},
+	})
+}
+
+func TestOptional(t *testing.T) {
+	type Wrapper struct {
+		Ignored int     `lcs:"-"`
+		Name    *string `lcs:"optional"`
+	}
+	hello := "hello"
+
+	type Wrapper2 struct {
+		Slice []byte `lcs:"optional"`
+	}
+	type Wrapper3 struct {
+		Map map[uint8]uint8 `lcs:"optional"`
+	}
+
+	runTest(t, []*testCase{
+		{
+			v: Wrapper{
+				Name: &hello,
+			},
+			b:    hexMustDecode("01 05 68656c6c6f"),
+			name: "struct with set optional fields",
+		},
+		{
+			v:    Wrapper{},
+			b:    hexMustDecode("00"),
+			name: "struct with unset optional fields",
+		},
+		{
+			v: Wrapper2{
+				Slice: []byte(hello),
+			},
+			b:    hexMustDecode("01 05 68656c6c6f"),
+			name: "struct with set optional slice",
+		},
+		{
+			v:    Wrapper2{},
+			b:    hexMustDecode("00"),
+			name: "struct with unset optional slice",
+		},
+		{
+			v: Wrapper3{
+				Map: map[uint8]uint8{1: 2},
+			},
+			b:    hexMustDecode("01 01 01 02"),
+			name: "struct with set optional map",
+		},
+		{
+			v:    Wrapper3{},
+			b:    hexMustDecode("00"),
+			name: "struct with unset optional map",
+		},
+	})
+}
+
+func TestMap(t *testing.T) {
+	runTest(t, []*testCase{
+		{
+			v:    map[uint8]string{1: "hello", 2: "world"},
+			b:    hexMustDecode("02 01 05 68656c6c6f 02 05 776f726c64"),
+			name: "map[uint8]string",
+		},
+		{
+			v:    map[string]uint8{"hello": 1, "world": 2},
+			b:    hexMustDecode("02 05 68656c6c6f 01 05 776f726c64 02"),
+			name: "map[string]uint8",
+		},
+	})
+}
+
+type Option0 struct {
+	Data uint32
+}
+type Option1 struct{}
+type Option2 bool
+type Option3 []byte
+type isOption interface {
+	isOption()
+}
+type Option struct {
+	Option isOption `lcs:"enum=option"`
+}
+type OptionalOption struct {
+	Option isOption `lcs:"optional,enum=option"`
+}
+
+func (*Option0) isOption() {}
+func (Option1) isOption()  {}
+func (Option2) isOption()  {}
+func (Option3) isOption()  {}
+
+var optionEnumDef = []EnumVariant{
+	{
+		Name:     "option",
+		Value:    0,
+		Template: (*Option0)(nil),
+	},
+	{
+		Name:     "option",
+		Value:    1,
+		Template: Option1{},
+	},
+	{
+		Name:     "option",
+		Value:    2,
+		Template: Option2(false),
+	},
+	{
+		Name:     "option",
+		Value:    3,
+		Template: Option3(nil),
+	},
+}
+
+func (*Option) EnumTypes() []EnumVariant         { return optionEnumDef }
+func (*OptionalOption) EnumTypes() []EnumVariant { return optionEnumDef }
+
+func TestEnum(t *testing.T) {
+	runTest(t, []*testCase{
+		{
+			v: &Option{
+				Option: &Option0{5},
+			},
+			b:    hexMustDecode("00 0500 0000"),
+			name: "ptr to struct with ptr enum variant",
+		},
+		{
+			v: &Option{
+				Option: Option1{},
+			},
+			b:    hexMustDecode("01"),
+			name: "ptr to struct with non-ptr empty variant",
+		},
+		{
+			v: &Option{
+				Option: Option2(true),
+			},
+			b:    hexMustDecode("02 01"),
+			name: "ptr to struct with real value as enum variant",
+		},
+		{
+			v: &Option{
+				Option: Option3([]byte{0x11, 0x22}),
+			},
+			b:    hexMustDecode("03 02 11 22"),
+			name: "ptr to struct with slice as enum variant",
+		},
+		{
+			v: &Option{
+				Option: Option3([]byte{}),
+			},
+			b:    hexMustDecode("03 00"),
+			name: "ptr to struct with nil slice as enum variant",
+		},
+		{
+			v: Option{
+				Option: Option1{},
+			},
+			b:    hexMustDecode("01"),
+			name: "non-ptr struct with variant",
+		},
+		{
+			v:    OptionalOption{},
+			name: "nil enum on optional field",
+			b:    hexMustDecode("00"),
+		},
+		{
+			v:             Option{},
+			name:          "nil variant on non-optional field",
+			skipUnmarshal: true,
+			errMarshal:    errors.New("non-optional enum value is nil"),
+		},
+	})
+}
+
+type OptionWrap struct {
+	OptionStruct    Option
+	OptionStructPtr *Option
+}
+
+func TestEnumInStruct(t *testing.T) {
+	runTest(t, []*testCase{
+		{
+			v: &OptionWrap{
+				OptionStruct: Option{
+					Option: Option3([]byte{0x11, 0x22}),
+				},
+				OptionStructPtr: &Option{
+					Option: Option1{},
+				},
+			},
+			b:    hexMustDecode("03 02 1122 01"),
+			name: "enum struct in struct",
+		},
+		{
+			v: &OptionWrap{
+				OptionStructPtr: &Option{
+					Option: Option3([]byte{0x11, 0x22}),
+				},
+				OptionStruct: Option{
+					Option: Option1{},
+				},
+			},
+			b:    hexMustDecode("01 03 02 1122"),
+			name: "enum struct in struct 2",
+		},
+	})
+}
+
+type OptionSlice struct {
+	Option []isOption `lcs:"enum=option"`
+}
+
+func (*OptionSlice) EnumTypes() []EnumVariant {
+	return []EnumVariant{
+		{
+			Name:     "option",
+			Value:    0,
+			Template: (*Option0)(nil),
+		},
+		{
+			Name:     "option",
+			Value:    1,
+			Template: Option1{},
+		},
+		{
+			Name:     "option",
+			Value:    2,
+			Template: Option2(false),
+		},
+	}
+}
+
+func TestEnumSlice(t *testing.T) {
+	runTest(t, []*testCase{
+		{
+			v: &OptionSlice{
+				Option: []isOption{
+					&Option0{5},
+					Option1{},
+					Option2(true),
+				},
+			},
+			b:    hexMustDecode("03 00 05000000 01 02 01"),
+			name: "enum slice",
+		},
+	})
+}
+
+type OptionSlice2D struct {
+	Option [][]isOption `lcs:"enum=option"`
+}
+
+func (*OptionSlice2D) EnumTypes() []EnumVariant {
+	return []EnumVariant{
+		{
+			Name:     "option",
+			Value:    0,
+			Template: (*Option0)(nil),
+		},
+		{
+			Name:     "option",
+			Value:    1,
+			Template: (*Option1)(nil),
+		},
+		{
+			Name:     "option",
+			Value:    2,
+			Template: Option2(false),
+		},
+	}
+}
+
+func TestEnum2DSlice(t *testing.T) {
+	runTest(t, []*testCase{
+		{
+			v: &OptionSlice2D{
+				Option: [][]isOption{
+					{
+						&Option0{5},
+						Option2(true),
+					},
+					{
+						Option2(false),
+					},
+				},
+			},
+			b:    hexMustDecode("02 02 00 05000000 02 01 01 02 00"),
+			name: "2D enum slice",
+		},
+	})
+}
+
+func TestULEB128(t *testing.T) {
+	type MyStruct struct {
+		Small uint8  `lcs:"uleb128"`
+		Big   uint64 `lcs:"uleb128"`
+	}
+	type WrongStruct struct {
+		Signed int32 `lcs:"uleb128"`
+	}
+
+	runTest(t, []*testCase{
+		{
+			v:    MyStruct{Small: 0x7f, Big: 0x4000},
+			b:    hexMustDecode("7f 808001"),
+			name: "uleb128 fields",
+		},
+		{
+			v:            MyStruct{},
+			b:            hexMustDecode("8002 00"),
+			skipMarshal:  true,
+			errUnmarshal: errors.New("leb128: invalid uint"),
+			name:         "uleb128 overflow",
+		},
+		{
+			v:             WrongStruct{},
+			errMarshal:    errors.New("uleb128 tag requires unsigned integer, got int32"),
+			skipUnmarshal: true,
+			name:          "uleb128 on signed int",
+		},
+	})
+}
+
+func TestPlatformInts(t *testing.T) {
+	type MyStruct struct {
+		Int  int     `lcs:"i64"`
+		Uint uint    `lcs:"u32"`
+		Ptr  uintptr `lcs:"u8"`
+	}
+	type Small struct {
+		Int int `lcs:"i8"`
+	}
+	type Narrow struct {
+		Int int8 `lcs:"i16"`
+	}
+	type Untagged struct {
+		Int int
+	}
+	type Conflicting struct {
+		Int int `lcs:"i8,u16"`
+	}
+	type ConflictingULEB128 struct {
+		Uint uint64 `lcs:"uleb128,u8"`
+	}
+
+	runTest(t, []*testCase{
+		{
+			v:    MyStruct{Int: -2, Uint: 0x12345678, Ptr: 0xff},
+			b:    hexMustDecode("FEFFFFFFFFFFFFFF 78563412 FF"),
+			name: "platform ints with width tags",
+		},
+		{
+			v:    Small{Int: -128},
+			b:    hexMustDecode("80"),
+			name: "int with narrow tag",
+		},
+		{
+			v:             Small{Int: 128},
+			errMarshal:    errors.New("value 128 overflows i8"),
+			skipUnmarshal: true,
+			name:          "int overflows width tag",
+		},
+		{
+			v:            Narrow{},
+			b:            hexMustDecode("0001"),
+			skipMarshal:  true,
+			errUnmarshal: errors.New("value 256 overflows int8"),
+			name:         "decoded value overflows field",
+		},
+		{
+			v:            Untagged{},
+			b:            hexMustDecode("00"),
+			errMarshal:   errors.New(`not supported kind: int, missing width tag such as lcs:"i32" or lcs:"i64"`),
+			errUnmarshal: errors.New(`not supported kind: int, missing width tag such as lcs:"i32" or lcs:"i64"`),
+			name:         "int without width tag",
+		},
+		{
+			v:             Conflicting{},
+			errMarshal:    errors.New("conflicting integer width tags: i8, u16"),
+			skipUnmarshal: true,
+			name:          "conflicting width tags",
+		},
+		{
+			v:             ConflictingULEB128{},
+			errMarshal:    errors.New("conflicting integer width tags: u8, uleb128"),
+			skipUnmarshal: true,
+			name:          "width tag with uleb128",
+		},
+	})
+}
+
+type ScopedTags struct {
+	Hashes   [][]byte           `lcs:"elem.len=2"`
+	Options  []*uint16          `lcs:"elem.optional"`
+	Payloads map[uint8]isOption `lcs:"value.enum=option"`
+	Nested   [][]*string        `lcs:"optional,elem.elem.optional"`
+	Counts   []uint64           `lcs:"elem.uleb128"`
+}
+
+func (*ScopedTags) EnumTypes() []EnumVariant { return optionEnumDef }
+
+func TestScopedTags(t *testing.T) {
+	one := uint16(1)
+	hello := "hello"
+
+	runTest(t, []*testCase{
+		{
+			v: &ScopedTags{
+				Hashes:   [][]byte{{0x11, 0x22}, {0x33, 0x44}},
+				Options:  []*uint16{&one, nil},
+				Payloads: map[uint8]isOption{1: Option2(true), 2: &Option0{5}},
+				Nested:   [][]*string{{nil, &hello}},
+				Counts:   []uint64{1, 300},
+			},
+			b: hexMustDecode("02 1122 3344" +
+				"02 01 0100 00" +
+				"02 01 02 01 02 00 05000000" +
+				"01 01 02 00 01 05 68656c6c6f" +
+				"02 01 ac02"),
+			name: "scoped tags",
+		},
+		{
+			v: &ScopedTags{
+				Hashes:   [][]byte{{0x11}},
+				Options:  []*uint16{},
+				Payloads: map[uint8]isOption{},
+				Counts:   []uint64{},
+			},
+			errMarshal:    errors.New("actual len not equal to fixed len"),
+			skipUnmarshal: true,
+			name:          "wrong elem len",
+		},
+	})
+}
+
+func TestSet(t *testing.T) {
+	type MySet struct {
+		Items []uint16 `lcs:"set"`
+		Names []string `lcs:"set"`
+	}
+	type WrongSet struct {
+		Items [2]uint16 `lcs:"set"`
+	}
+
+	runTest(t, []*testCase{
+		{
+			v:    MySet{Items: []uint16{0x100, 1}, Names: []string{"a", "b"}},
+			b:    hexMustDecode("02 0001 0100 02 0161 0162"),
+			name: "sorted set",
+		},
+		{
+			v:             MySet{Items: []uint16{1, 0x100, 1}, Names: []string{"b", "a", "b"}},
+			b:             hexMustDecode("02 0001 0100 02 0161 0162"),
+			skipUnmarshal: true,
+			name:          "unsorted set with duplicates",
+		},
+		{
+			v:            MySet{},
+			b:            hexMustDecode("02 0100 0001 00"),
+			skipMarshal:  true,
+			errUnmarshal: errors.New("set elements not in canonical order or duplicated"),
+			name:         "unsorted set bytes",
+		},
+		{
+			v:            MySet{},
+			b:            hexMustDecode("02 0100 0100 00"),
+			skipMarshal:  true,
+			errUnmarshal: errors.New("set elements not in canonical order or duplicated"),
+			name:         "duplicated set bytes",
+		},
+		{
+			v:             WrongSet{},
+			errMarshal:    errors.New("set tag requires slice, got array"),
+			skipUnmarshal: true,
+			name:          "set tag on array",
+		},
+		{
+			v:    map[uint16]struct{}{1: {}, 0x100: {}},
+			b:    hexMustDecode("02 0001 0100"),
+			name: "map as set",
+		},
+		{
+			v:            map[uint16]struct{}{},
+			b:            hexMustDecode("02 0100 0001"),
+			skipMarshal:  true,
+			errUnmarshal: errors.New("set elements not in canonical order or duplicated"),
+			name:         "unsorted map as set",
+		},
+	})
+}
+
+func TestCompare(t *testing.T) {
+	c, err := Compare(uint16(0x100), uint16(1))
+	assert.NoError(t, err)
+	assert.Equal(t, -1, c)
+
+	c, err = Compare("b", "ab")
+	assert.NoError(t, err)
+	assert.Equal(t, -1, c)
+
+	c, err = Compare([]byte{1, 2}, []byte{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, c)
+
+	_, err = Compare(1.0, 2.0)
+	assert.Error(t, err)
+}
+
+func TestOrderedMap(t *testing.T) {
+	type Entry struct {
+		Key   []byte
+		Value []byte
+	}
+	type AccountState struct {
+		Resources []Entry `lcs:"map"`
+	}
+	type FixedEntry struct {
+		Key   []byte `lcs:"len=2"`
+		Value uint8
+	}
+	type FixedMap struct {
+		Entries []FixedEntry `lcs:"map"`
+	}
+	type WrongEntry struct {
+		Key []byte
+	}
+	type WrongMap struct {
+		Entries []WrongEntry `lcs:"map"`
+	}
+
+	runTest(t, []*testCase{
+		{
+			v: AccountState{Resources: []Entry{
+				{Key: []byte{0x01}, Value: []byte{0xaa}},
+				{Key: []byte{0x01, 0x00}, Value: []byte{0xbb}},
+			}},
+			b:    hexMustDecode("02 0101 01aa 020100 01bb"),
+			name: "bytes map",
+		},
+		{
+			v: AccountState{Resources: []Entry{
+				{Key: []byte{0x01, 0x00}, Value: []byte{0xbb}},
+				{Key: []byte{0x01}, Value: []byte{0xaa}},
+			}},
+			b:           hexMustDecode("02 020100 01bb 0101 01aa"),
+			skipMarshal: true,
+			name:        "decode in wire order",
+		},
+		{
+			v: AccountState{Resources: []Entry{
+				{Key: []byte{0x01, 0x00}, Value: []byte{0xbb}},
+				{Key: []byte{0x01}, Value: []byte{0xaa}},
+			}},
+			b:             hexMustDecode("02 0101 01aa 020100 01bb"),
+			skipUnmarshal: true,
+			name:          "encode sorted by key",
+		},
+		{
+			v: FixedMap{Entries: []FixedEntry{
+				{Key: []byte{0x02, 0x00}, Value: 1},
+				{Key: []byte{0x01, 0x00}, Value: 2},
+			}},
+			b:             hexMustDecode("02 0100 02 0200 01"),
+			skipUnmarshal: true,
+			name:          "entry field tags",
+		},
+		{
+			v: AccountState{Resources: []Entry{
+				{Key: []byte{0x01}, Value: []byte{0xaa}},
+				{Key: []byte{0x01}, Value: []byte{0xbb}},
+			}},
+			errMarshal:    errors.New("duplicated map key"),
+			skipUnmarshal: true,
+			name:          "duplicated key",
+		},
+		{
+			v:            WrongMap{},
+			b:            hexMustDecode("00"),
+			errMarshal:   errors.New("map entry lcs.WrongEntry should have exactly 2 fields"),
+			errUnmarshal: errors.New("map entry lcs.WrongEntry should have exactly 2 fields"),
+			name:         "wrong entry type",
+		},
+	})
+}
+
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) { return 0, errors.New("write error") }
+
+func TestWriteError(t *testing.T) {
+	e := NewEncoder(errWriter{})
+	assert.EqualError(t, e.Encode(map[uint8]uint8{1: 2}), "write error")
+	assert.EqualError(t, e.Encode(make([]byte, 10000)), "write error")
+}
+
+func TestNestedMap(t *testing.T) {
+	runTest(t, []*testCase{
+		{
+			v: map[uint8]map[uint8][]uint8{
+				2: {1: {0x11}},
+				1: {3: {0x22}, 2: {}},
+			},
+			b:    hexMustDecode("02 01 02 02 00 03 01 22 02 01 01 01 11"),
+			name: "nested maps",
+		},
+	})
+}
+
+func TestDecoderStream(t *testing.T) {
+	data := hexMustDecode("01 0500 02 0161 0162 00 ffff 00")
+	d := NewDecoder(onlyReader{bytes.NewReader(data)})
+
+	var b bool
+	var u uint16
+	var s []string
+	var i int16
+	assert.NoError(t, d.Decode(&b))
+	assert.NoError(t, d.Decode(&u))
+	assert.NoError(t, d.Decode(&s))
+	assert.NoError(t, d.Decode(&b))
+	assert.NoError(t, d.Decode(&i))
+	assert.Equal(t, false, b)
+	assert.Equal(t, uint16(5), u)
+	assert.Equal(t, []string{"a", "b"}, s)
+	assert.Equal(t, int16(-1), i)
+	assert.False(t, d.EOF())
+	assert.True(t, d.EOF())
+
+	err := Unmarshal(hexMustDecode("0500"), &i)
+	assert.NoError(t, err)
+	err = Unmarshal(hexMustDecode("05"), &i)
+	assert.EqualError(t, err, "unexpected EOF")
+	err = Unmarshal(hexMustDecode(""), &i)
+	assert.EqualError(t, err, "EOF")
+	err = Unmarshal(hexMustDecode("02"), &b)
+	assert.EqualError(t, err, "unexpected value for bool")
+
+	// the decoder does not read ahead, so the rest of the stream can be read directly
+	r := onlyReader{bytes.NewReader(hexMustDecode("02 0161 0162 ffff"))}
+	assert.NoError(t, NewDecoder(r).Decode(&s))
+	assert.Equal(t, []string{"a", "b"}, s)
+	rest, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xff, 0xff}, rest)
+}
+
+func TestBulkSlice(t *testing.T) {
+	type MyUint32 uint32
+	type MyBool bool
+	v64 := [3]uint64{1, 2, 1 << 63}
+
+	runTest(t, []*testCase{
+		{
+			v:    []uint64{1, 1 << 63},
+			b:    hexMustDecode("02 0100000000000000 0000000000000080"),
+			name: "uint64 slice",
+		},
+		{
+			v:    []int16{-2, 3},
+			b:    hexMustDecode("02 feff 0300"),
+			name: "int16 slice",
+		},
+		{
+			v:    []int8{-1, 1},
+			b:    hexMustDecode("02 ff 01"),
+			name: "int8 slice",
+		},
+		{
+			v:    []int32{-1},
+			b:    hexMustDecode("01 ffffffff"),
+			name: "int32 slice",
+		},
+		{
+			v:    []int64{-1},
+			b:    hexMustDecode("01 ffffffffffffffff"),
+			name: "int64 slice",
+		},
+		{
+			v:    []bool{true, false},
+			b:    hexMustDecode("02 01 00"),
+			name: "bool slice",
+		},
+		{
+			v:            []bool{},
+			b:            hexMustDecode("02 01 02"),
+			skipMarshal:  true,
+			errUnmarshal: errors.New("unexpected value for bool"),
+			name:         "invalid bool slice",
+		},
+		{
+			v:    []MyUint32{1, 0x12345678},
+			b:    hexMustDecode("02 01000000 78563412"),
+			name: "named uint32 slice",
+		},
+		{
+			v:    []MyBool{true},
+			b:    hexMustDecode("01 01"),
+			name: "named bool slice",
+		},
+		{
+			v:            []MyBool{},
+			b:            hexMustDecode("01 05"),
+			skipMarshal:  true,
+			errUnmarshal: errors.New("unexpected value for bool"),
+			name:         "invalid named bool slice",
+		},
+		{
+			v:    &v64,
+			b:    hexMustDecode("0100000000000000 0200000000000000 0000000000000080"),
+			name: "uint64 array",
+		},
+		{
+			v:    [2]int16{-1, 1},
+			b:    hexMustDecode("ffff 0100"),
+			name: "unaddressable int16 array",
+		},
+		{
+			v:            []uint32{},
+			b:            hexMustDecode("02 01000000 0100"),
+			skipMarshal:  true,
+			errUnmarshal: errors.New("unexpected EOF"),
+			name:         "short uint32 slice",
+		},
+	})
+
+	// a corrupt length fails before the slice is allocated, or while it grows from a stream
+	var s []uint64
+	assert.EqualError(t, Unmarshal(hexMustDecode("ffffff7f 00"), &s), "unexpected EOF")
+	err := NewDecoder(bytes.NewReader(hexMustDecode("ffffff7f 00"))).Decode(&s)
+	assert.EqualError(t, err, "unexpected EOF")
+
+	// a stream of several chunks
+	long := make([]uint64, 3*bulkChunkSize/8+5)
+	for i := range long {
+		long[i] = uint64(i) << 32
+	}
+	b, err := Marshal(long)
+	assert.NoError(t, err)
+	err = NewDecoder(onlyReader{bytes.NewReader(b)}).Decode(&s)
+	assert.NoError(t, err)
+	assert.Equal(t, long, s)
+}
+
+func TestBulkSliceOver100MB(t *testing.T) {
+	if testing.Short() {
+		t.Skip("allocates several hundred MB")
+	}
+	in := make([]uint64, maxByteSliceSize/8+1)
+	in[len(in)-1] = 7
+	b, err := Marshal(in)
+	assert.NoError(t, err)
+	var out []uint64
+	assert.NoError(t, Unmarshal(b, &out))
+	assert.Equal(t, len(in), len(out))
+	assert.Equal(t, uint64(7), out[len(out)-1])
+
+	n := 0
+	_, err = Extract(b, reflect.TypeOf(in), "[0]")
+	assert.NoError(t, err)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(nil, len(b))
+	scanner.Split(SplitFunc(reflect.TypeOf(in)))
+	for scanner.Scan() {
+		n++
+	}
+	assert.NoError(t, scanner.Err())
+	assert.Equal(t, 1, n)
+}
+
+func TestZeroCopy(t *testing.T) {
+	type MyStruct struct {
+		Bytes []byte
+		Str   string
+		Fixed [2]byte
+	}
+	data := hexMustDecode("02 1122 05 68656c6c6f 3344")
+
+	out := &MyStruct{}
+	err := UnmarshalWithOptions(data, out, DecoderOptions{ZeroCopy: true, ZeroCopyStrings: true})
+	assert.NoError(t, err)
+	assert.Equal(t, &MyStruct{Bytes: []byte{0x11, 0x22}, Str: "hello", Fixed: [2]byte{0x33, 0x44}}, out)
+	assert.Equal(t, 2, cap(out.Bytes))
+
+	// with ZeroCopyStrings the input must never be modified, so aliasing is checked with
+	// ZeroCopy alone, which only applies to byte slices
+	out = &MyStruct{}
+	err = UnmarshalWithOptions(data, out, DecoderOptions{ZeroCopy: true})
+	assert.NoError(t, err)
+	data[1], data[4], data[9] = 0xff, 'j', 0xff
+	assert.Equal(t, []byte{0xff, 0x22}, out.Bytes)
+	assert.Equal(t, "hello", out.Str)
+	assert.Equal(t, [2]byte{0x33, 0x44}, out.Fixed)
+
+	copied := &MyStruct{}
+	err = UnmarshalWithOptions(data, copied, DecoderOptions{})
+	assert.NoError(t, err)
+	data[1] = 0x11
+	assert.Equal(t, []byte{0xff, 0x22}, copied.Bytes)
+	assert.Equal(t, "jello", copied.Str)
+
+	d := NewDecoderWithOptions(bytes.NewReader(data), DecoderOptions{ZeroCopy: true})
+	assert.EqualError(t, d.Decode(out), "zero copy decoding requires in-memory input")
+}
+
+func TestDecodeReuse(t *testing.T) {
+	type Item struct {
+		Name  string
+		Bytes []byte
+	}
+	type MyStruct struct {
+		Items  []Item
+		Values []uint32
+		Bytes  []byte
+		Map    map[uint8]uint8
+	}
+	data := hexMustDecode("01 0161 0111 02 01000000 02000000 01 22 01 0102")
+
+	out := &MyStruct{
+		Items:  make([]Item, 3, 4),
+		Values: make([]uint32, 0, 4),
+		Bytes:  make([]byte, 0, 4),
+		Map:    map[uint8]uint8{5: 6},
+	}
+	out.Items[0].Bytes = make([]byte, 0, 4)
+	items, itemBytes, values, bs, m := &out.Items[:1][0], &out.Items[0].Bytes[:1][0], &out.Values[:1][0], &out.Bytes[:1][0], out.Map
+
+	err := UnmarshalWithOptions(data, out, DecoderOptions{Reuse: true})
+	assert.NoError(t, err)
+	assert.Equal(t, &MyStruct{
+		Items:  []Item{{Name: "a", Bytes: []byte{0x11}}},
+		Values: []uint32{1, 2},
+		Bytes:  []byte{0x22},
+		Map:    map[uint8]uint8{1: 2},
+	}, out)
+	assert.True(t, items == &out.Items[0])
+	assert.True(t, itemBytes == &out.Items[0].Bytes[0])
+	assert.True(t, values == &out.Values[0])
+	assert.True(t, bs == &out.Bytes[0])
+	assert.Equal(t, reflect.ValueOf(m).Pointer(), reflect.ValueOf(out.Map).Pointer())
+
+	// without Reuse, new memory is allocated
+	err = Unmarshal(data, out)
+	assert.NoError(t, err)
+	assert.False(t, values == &out.Values[0])
+	assert.NotEqual(t, reflect.ValueOf(m).Pointer(), reflect.ValueOf(out.Map).Pointer())
+}
+
+func TestCorruptLength(t *testing.T) {
+	var s []uint32
+	assert.EqualError(t, Unmarshal(hexMustDecode("ffff7f 00"), &s), "unexpected EOF")
+	var ss []string
+	assert.EqualError(t, Unmarshal(hexMustDecode("ffff7f 00"), &ss), "EOF")
+	var b []byte
+	assert.EqualError(t, Unmarshal(hexMustDecode("ffff7f 00"), &b), "unexpected EOF")
+}
+
+func TestSeq(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	seq, err := e.BeginSeq(3)
+	assert.NoError(t, err)
+	for _, s := range []string{"a", "bc", ""} {
+		assert.NoError(t, seq.Encode(s))
+	}
+	assert.EqualError(t, seq.Encode("d"), "sequence has more elements than its length 3")
+	assert.NoError(t, seq.End())
+	assert.NoError(t, e.Encode(uint8(5)))
+	expected, err := Marshal([]string{"a", "bc", ""})
+	assert.NoError(t, err)
+	assert.Equal(t, append(expected, 5), buf.Bytes())
+
+	seq, err = NewEncoder(&buf).BeginSeq(2)
+	assert.NoError(t, err)
+	assert.NoError(t, seq.Encode(uint16(1)))
+	assert.EqualError(t, seq.Encode(uint32(1)), "sequence element type uint32 differs from uint16")
+	assert.EqualError(t, seq.End(), "sequence has 1 elements, less than its length 2")
+
+	_, err = NewEncoder(&buf).BeginSeq(-1)
+	assert.EqualError(t, err, "sequence length -1 out of range")
+
+	d := NewDecoder(onlyReader{bytes.NewReader(append(expected, 5))})
+	dseq, err := d.Seq()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, dseq.Len())
+	var got []string
+	for dseq.More() {
+		var s string
+		assert.NoError(t, dseq.Decode(&s))
+		got = append(got, s)
+	}
+	assert.Equal(t, []string{"a", "bc", ""}, got)
+	var s string
+	assert.EqualError(t, dseq.Decode(&s), "no more elements in sequence")
+	var u uint8
+	assert.NoError(t, d.Decode(&u))
+	assert.Equal(t, uint8(5), u)
+
+	_, err = NewDecoderFromBytes(hexMustDecode("ffffffff0f"), DecoderOptions{}).Seq()
+	assert.EqualError(t, err, "leb128: invalid uint")
+}
+
+func TestBytesStream(t *testing.T) {
+	payload := bytes.Repeat([]byte{0xab}, 300)
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	assert.NoError(t, e.EncodeBytesFrom(bytes.NewReader(payload), int64(len(payload))))
+	assert.NoError(t, e.Encode(uint8(5)))
+	expected, err := Marshal(payload)
+	assert.NoError(t, err)
+	assert.Equal(t, append(expected, 5), buf.Bytes())
+
+	err = NewEncoder(&buf).EncodeBytesFrom(bytes.NewReader(payload), 301)
+	assert.EqualError(t, err, "read 300 bytes, less than length 301")
+
+	for _, d := range []*Decoder{
+		NewDecoder(onlyReader{bytes.NewReader(append(expected, 5))}),
+		NewDecoderFromBytes(append(expected, 5), DecoderOptions{}),
+	} {
+		var out bytes.Buffer
+		n, err := d.DecodeBytesTo(&out)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(300), n)
+		assert.Equal(t, payload, out.Bytes())
+		var u uint8
+		assert.NoError(t, d.Decode(&u))
+		assert.Equal(t, uint8(5), u)
+	}
+
+	var out bytes.Buffer
+	_, err = NewDecoderFromBytes(hexMustDecode("03 0102"), DecoderOptions{}).DecodeBytesTo(&out)
+	assert.EqualError(t, err, "unexpected EOF")
+}
+
+type hookTestPayment struct {
+	Amount uint64
+	Memo   string
+}
+
+var errHookTestAmount = errors.New("amount should be positive")
+
+func (p *hookTestPayment) ValidateLCS() error {
+	if p.Amount == 0 {
+		return errHookTestAmount
+	}
+	return nil
+}
+
+func (p *hookTestPayment) BeforeEncodeLCS() error {
+	if p.Amount == 0 {
+		return errHookTestAmount
+	}
+	if p.Memo == "" {
+		p.Memo = "none"
+	}
+	return nil
+}
+
+type hookTestBatch struct {
+	Payments []hookTestPayment
+	ByName   map[string]*hookTestPayment
+	Entries  []struct {
+		Key   uint8
+		Value hookTestPayment
+	} `lcs:"map"`
+}
+
+func TestHooks(t *testing.T) {
+	// the hook fills Memo on a copy when the value is not addressable
+	b, err := Marshal(hookTestPayment{Amount: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, hexMustDecode("0100000000000000 046e6f6e65"), b)
+
+	p := &hookTestPayment{Amount: 1}
+	_, err = Marshal(p)
+	assert.NoError(t, err)
+	assert.Equal(t, "none", p.Memo)
+
+	_, err = Marshal(hookTestPayment{})
+	assert.EqualError(t, err, "amount should be positive")
+	var out hookTestPayment
+	err = Unmarshal(hexMustDecode("0000000000000000 00"), &out)
+	assert.EqualError(t, err, "amount should be positive")
+	assert.IsType(t, &HookError{}, err)
+	assert.True(t, errors.Is(err, errHookTestAmount))
+
+	batch := &hookTestBatch{
+		Payments: []hookTestPayment{{Amount: 1}, {Amount: 0}},
+	}
+	_, err = Marshal(batch)
+	assert.EqualError(t, err, "Payments[1]: amount should be positive")
+
+	batch.Payments = nil
+	batch.ByName = map[string]*hookTestPayment{"a": {Amount: 1}, "b": {}}
+	_, err = Marshal(batch)
+	assert.EqualError(t, err, `ByName["b"]: amount should be positive`)
+
+	batch.ByName = nil
+	batch.Entries = []struct {
+		Key   uint8
+		Value hookTestPayment
+	}{{Key: 3}}
+	_, err = Marshal(batch)
+	assert.EqualError(t, err, "Entries[0].Value: amount should be positive")
+
+	var decoded hookTestBatch
+	err = Unmarshal(hexMustDecode("01 0100000000000000 00 01 016b 0000000000000000 00 00"), &decoded)
+	if assert.IsType(t, &HookError{}, err) {
+		assert.Equal(t, `ByName["k"]`, err.(*HookError).Path)
+		assert.EqualError(t, err, `ByName["k"]: amount should be positive`)
+		assert.True(t, errors.Is(err, errHookTestAmount))
+	}
+	err = Unmarshal(hexMustDecode("00 00 01 03 0000000000000000 00"), &decoded)
+	assert.EqualError(t, err, "Entries[0].Value: amount should be positive")
+}
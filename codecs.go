@@ -0,0 +1,92 @@
+package lcs
+
+import (
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// RegisterBigIntCodec registers a codec which encodes *big.Int as an unsigned integer of the
+// given size in bits, e.g. 128 for u128 or 256 for u256. Negative and overflowing values are
+// rejected.
+//
+// This function panics on errors.
+func (r *Registry) RegisterBigIntCodec(bits int) {
+	if bits <= 0 || bits%8 != 0 {
+		panic("big.Int codec bits should be a positive multiple of 8")
+	}
+	size := bits / 8
+	name := "u" + strconv.Itoa(bits)
+	r.RegisterCodec(reflect.TypeOf((*big.Int)(nil)),
+		func(e *Encoder, v reflect.Value) error {
+			x := v.Interface().(*big.Int)
+			if x == nil {
+				return errors.New("nil *big.Int")
+			}
+			if x.Sign() < 0 || x.BitLen() > bits {
+				return errors.New("value " + x.String() + " overflows " + name)
+			}
+			b := make([]byte, size)
+			xb := x.Bytes()
+			for i, c := range xb {
+				b[len(xb)-1-i] = c
+			}
+			_, err := e.w.Write(b)
+			return err
+		},
+		func(d *Decoder, v reflect.Value) error {
+			b := make([]byte, size)
+			if _, err := io.ReadFull(d.r, b); err != nil {
+				return err
+			}
+			for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+				b[i], b[j] = b[j], b[i]
+			}
+			v.Set(reflect.ValueOf(new(big.Int).SetBytes(b)))
+			return nil
+		},
+	)
+}
+
+// RegisterTimeCodec registers a codec which encodes time.Time as u64 microseconds since the
+// unix epoch. Times before the epoch, or too late to fit in u64, are rejected, and decoded
+// times are in UTC.
+func (r *Registry) RegisterTimeCodec() {
+	r.RegisterCodec(reflect.TypeOf(time.Time{}),
+		func(e *Encoder, v reflect.Value) error {
+			t := v.Interface().(time.Time)
+			if t.Unix() < 0 {
+				return errors.New("time before unix epoch: " + t.String())
+			}
+			secs, us := uint64(t.Unix()), uint64(t.Nanosecond()/1e3)
+			if secs > math.MaxUint64/1000000 || secs*1e6 > math.MaxUint64-us {
+				return errors.New("time overflows u64 microseconds: " + t.String())
+			}
+			return e.writeUint(secs*1e6+us, 8)
+		},
+		func(d *Decoder, v reflect.Value) error {
+			micros, err := d.readUint(8)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(time.Unix(int64(micros/1e6), int64(micros%1e6)*1e3).UTC()))
+			return nil
+		},
+	)
+}
+
+// RegisterBigIntCodec registers the *big.Int codec in the DefaultRegistry.
+// See Registry.RegisterBigIntCodec for details.
+func RegisterBigIntCodec(bits int) {
+	DefaultRegistry.RegisterBigIntCodec(bits)
+}
+
+// RegisterTimeCodec registers the time.Time codec in the DefaultRegistry.
+// See Registry.RegisterTimeCodec for details.
+func RegisterTimeCodec() {
+	DefaultRegistry.RegisterTimeCodec()
+}
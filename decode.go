@@ -1,340 +1,728 @@
-package lcs
-
-import (
-	"bytes"
-	"encoding/binary"
-	"errors"
-	"fmt"
-	"io"
-	"reflect"
-	"strconv"
-)
-
-type Decoder struct {
-	r     io.Reader
-	enums map[reflect.Type]map[string]map[EnumKeyType]reflect.Type
-}
-
-func NewDecoder(r io.Reader) *Decoder {
-	return &Decoder{
-		r:     r,
-		enums: make(map[reflect.Type]map[string]map[EnumKeyType]reflect.Type),
-	}
-}
-
-func (d *Decoder) Decode(v interface{}) error {
-	err := d.decode(reflect.Indirect(reflect.ValueOf(v)), nil, 0)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func (d *Decoder) EOF() bool {
-	_, err := d.r.Read(make([]byte, 1))
-	if err == io.EOF {
-		return true
-	}
-	return false
-}
-
-func (d *Decoder) decode(rv reflect.Value, enumVariants map[EnumKeyType]reflect.Type, fixedLen int) (err error) {
-	switch rv.Kind() {
-	case reflect.Bool:
-		if !rv.CanSet() {
-			return errors.New("bool value cannot set")
-		}
-		v8 := uint8(0)
-		if err = binary.Read(d.r, binary.LittleEndian, &v8); err != nil {
-			return
-		}
-		if v8 == 1 {
-			rv.SetBool(true)
-		} else if v8 == 0 {
-			rv.SetBool(false)
-		} else {
-			return errors.New("unexpected value for bool")
-		}
-	case /*reflect.Int,*/ reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
-		/*reflect.Uint,*/ reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		if !rv.CanSet() {
-			return errors.New("integer value cannot set")
-		}
-		err = binary.Read(d.r, binary.LittleEndian, rv.Addr().Interface())
-	case reflect.Slice:
-		err = d.decodeSlice(rv, enumVariants, fixedLen)
-	case reflect.Array:
-		err = d.decodeArray(rv, enumVariants, fixedLen)
-	case reflect.String:
-		err = d.decodeString(rv, fixedLen)
-	case reflect.Struct:
-		err = d.decodeStruct(rv)
-	case reflect.Map:
-		err = d.decodeMap(rv)
-	case reflect.Ptr:
-		if rv.IsNil() {
-			rv.Set(reflect.New(rv.Type().Elem()))
-		}
-		err = d.decode(rv.Elem(), enumVariants, fixedLen)
-	case reflect.Interface:
-		err = d.decodeInterface(rv, enumVariants)
-	default:
-		err = errors.New("not supported kind: " + rv.Kind().String())
-	}
-	return
-}
-
-func (d *Decoder) decodeByteSlice(fixedLen int) (b []byte, err error) {
-	l := uint32(fixedLen)
-	if l == 0 {
-		l1, err := readVarUint(d.r, 28)
-		if err != nil {
-			return nil, err
-		}
-		l = uint32(l1)
-		if l > maxByteSliceSize {
-			return nil, errors.New("byte slice longer than 100MB not supported")
-		}
-	}
-	b = make([]byte, l)
-	if _, err = io.ReadFull(d.r, b); err != nil {
-		return
-	}
-	return
-}
-
-func (d *Decoder) decodeSlice(rv reflect.Value, enumVariants map[EnumKeyType]reflect.Type, fixedLen int) (err error) {
-	if !rv.CanSet() {
-		return errors.New("slice cannot set")
-	}
-	if rv.Type() == reflect.TypeOf([]byte{}) {
-		var b []byte
-		if b, err = d.decodeByteSlice(fixedLen); err != nil {
-			return
-		}
-		rv.SetBytes(b)
-		return
-	}
-
-	l := uint32(fixedLen)
-	var cap int
-	if l == 0 {
-		l1, err := readVarUint(d.r, 28)
-		if err != nil {
-			return err
-		}
-		l = uint32(l1)
-		cap = int(l)
-		if cap > sliceAndMapInitSize {
-			cap = sliceAndMapInitSize
-		}
-	}
-	s := reflect.MakeSlice(rv.Type(), 0, cap)
-	for i := 0; i < int(l); i++ {
-		v := reflect.New(rv.Type().Elem())
-		if err = d.decode(v.Elem(), enumVariants, 0); err != nil {
-			return
-		}
-		s = reflect.Append(s, v.Elem())
-	}
-	rv.Set(s)
-	return
-}
-
-func (d *Decoder) decodeMap(rv reflect.Value) (err error) {
-	if !rv.CanSet() {
-		return errors.New("map cannot set")
-	}
-
-	l1, err := readVarUint(d.r, 28)
-	if err != nil {
-		return
-	}
-	l := uint32(l1)
-	cap := int(l)
-	if cap > sliceAndMapInitSize {
-		cap = sliceAndMapInitSize
-	}
-	m := reflect.MakeMapWithSize(rv.Type(), cap)
-	for i := 0; i < int(l); i++ {
-		k := reflect.New(rv.Type().Key())
-		v := reflect.New(rv.Type().Elem())
-		if err = d.decode(k, nil, 0); err != nil {
-			return
-		}
-		if err = d.decode(v, nil, 0); err != nil {
-			return
-		}
-		m.SetMapIndex(k.Elem(), v.Elem())
-	}
-	rv.Set(m)
-	return
-}
-
-func (d *Decoder) decodeArray(rv reflect.Value, enumVariants map[EnumKeyType]reflect.Type, fixedLen int) (err error) {
-	if !rv.CanSet() {
-		return errors.New("array cannot set")
-	}
-	if rv.Kind() == reflect.Array {
-		fixedLen = rv.Len()
-	}
-	if rv.Type().Elem() == reflect.TypeOf(byte(0)) {
-		var b []byte
-		if b, err = d.decodeByteSlice(fixedLen); err != nil {
-			return
-		}
-		if len(b) != rv.Len() {
-			return errors.New("length mismatch")
-		}
-		reflect.Copy(rv, reflect.ValueOf(b))
-		return
-	}
-
-	l := uint32(fixedLen)
-	if l == 0 {
-		l1, err := readVarUint(d.r, 28)
-		if err != nil {
-			return err
-		}
-		l = uint32(l1)
-	}
-	if int(l) != rv.Len() {
-		return errors.New("length mismatch")
-	}
-	for i := 0; i < int(l); i++ {
-		if err = d.decode(rv.Index(i), enumVariants, 0); err != nil {
-			return
-		}
-	}
-	return
-}
-
-func (d *Decoder) decodeString(rv reflect.Value, fixedLen int) (err error) {
-	if !rv.CanSet() {
-		return errors.New("string cannot set")
-	}
-	var b []byte
-	if b, err = d.decodeByteSlice(fixedLen); err != nil {
-		return
-	}
-	rv.SetString(string(b))
-	return
-}
-
-func (d *Decoder) decodeInterface(rv reflect.Value, enumVariants map[EnumKeyType]reflect.Type) (err error) {
-	typeVal, err := readVarUint(d.r, 28)
-	if err != nil {
-		return
-	}
-	tpl, ok := enumGetTypeByIdx(rv.Type(), typeVal)
-	if !ok {
-		tpl, ok = enumVariants[typeVal]
-		if !ok {
-			return fmt.Errorf("enum variant value %d unknown for interface: %s", typeVal, rv.Type())
-		}
-	}
-	if tpl.Kind() == reflect.Ptr {
-		rv1 := reflect.New(tpl.Elem())
-		if err = d.decode(rv1, nil, 0); err != nil {
-			return
-		}
-		rv.Set(rv1)
-	} else {
-		rv1 := reflect.New(tpl)
-		if err = d.decode(rv1, nil, 0); err != nil {
-			return
-		}
-		rv.Set(rv1.Elem())
-	}
-	return nil
-}
-
-func (d *Decoder) decodeStruct(rv reflect.Value) (err error) {
-	if !rv.CanSet() {
-		return errors.New("struct cannot set")
-	}
-	rt := rv.Type()
-	for i := 0; i < rv.NumField(); i++ {
-		fv := rv.Field(i)
-		if !fv.CanSet() {
-			continue
-		}
-		if rt.Field(i).Tag.Get(lcsTagName) == "-" {
-			continue
-		}
-		tag := parseTag(rt.Field(i).Tag.Get(lcsTagName))
-		var evs map[EnumKeyType]reflect.Type
-		if enumName, ok := tag["enum"]; ok {
-			evsAll, ok := d.enums[rv.Type()]
-			if !ok {
-				if evsAll = d.getEnumVariants(rv); evsAll != nil {
-					d.enums[rv.Type()] = evsAll
-				}
-			}
-			if evsAll == nil {
-				return fmt.Errorf("struct (%s) does not implement EnumTypeUser", rv.Type())
-			}
-			evs, ok = evsAll[enumName]
-			if !ok {
-				return errors.New("enum variants not defined for enum name: " + enumName)
-			}
-		}
-
-		if _, ok := tag["optional"]; ok &&
-			(fv.Kind() == reflect.Ptr ||
-				fv.Kind() == reflect.Slice ||
-				fv.Kind() == reflect.Map ||
-				fv.Kind() == reflect.Interface) {
-			rb := reflect.New(reflect.TypeOf(false))
-			if err = d.decode(rb, nil, 0); err != nil {
-				return
-			}
-			if !rb.Elem().Bool() {
-				fv.Set(reflect.Zero(fv.Type()))
-				continue
-			}
-		}
-		fixedLen := 0
-		if fixedLenStr, ok := tag["len"]; ok && (fv.Kind() == reflect.Slice || fv.Kind() == reflect.String) {
-			fixedLen, err = strconv.Atoi(fixedLenStr)
-			if err != nil {
-				return errors.New("tag len parse error: " + err.Error())
-			}
-		}
-		if err = d.decode(fv, evs, fixedLen); err != nil {
-			return
-		}
-	}
-	return
-}
-
-func (d *Decoder) getEnumVariants(rv reflect.Value) map[string]map[EnumKeyType]reflect.Type {
-	vv, ok := rv.Interface().(EnumTypeUser)
-	if !ok {
-		vv, ok = reflect.New(reflect.PtrTo(rv.Type())).Elem().Interface().(EnumTypeUser)
-		if !ok {
-			return nil
-		}
-	}
-	r := make(map[string]map[EnumKeyType]reflect.Type)
-	evs := vv.EnumTypes()
-	for _, ev := range evs {
-		evt := reflect.TypeOf(ev.Template)
-		if r[ev.Name] == nil {
-			r[ev.Name] = make(map[EnumKeyType]reflect.Type)
-		}
-		r[ev.Name][ev.Value] = evt
-	}
-	return r
-}
-
-func Unmarshal(data []byte, v interface{}) error {
-	d := NewDecoder(bytes.NewReader(data))
-	if err := d.Decode(v); err != nil {
-		return err
-	}
-	if !d.EOF() {
-		return errors.New("unexpected data")
-	}
-	return nil
-}
+package lcs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+type Decoder struct {
+	r       decReader
+	opts    DecoderOptions
+	enums   map[reflect.Type]map[string]map[EnumKeyType]reflect.Type
+	scratch [8]byte
+}
+
+// DecoderOptions are the options of a Decoder.
+type DecoderOptions struct {
+	// Registry holds the custom codecs. DefaultRegistry is used if it is nil.
+	Registry *Registry
+
+	// ZeroCopy makes decoded []byte values alias the input data instead of copying it.
+	// It is only valid with in-memory input, i.e. UnmarshalWithOptions or
+	// NewDecoderFromBytes.
+	//
+	// The decoded slices share memory with the input: modifying the input changes the
+	// decoded values and vice versa, and the whole input is kept alive as long as any
+	// decoded slice is. Their capacity is limited, so appending to them reallocates.
+	ZeroCopy bool
+
+	// ZeroCopyStrings makes decoded strings alias the input data instead of copying it.
+	// It is only valid with in-memory input, like ZeroCopy.
+	//
+	// Go strings are immutable, so the input must never be modified after decoding, as
+	// long as any decoded string is in use.
+	ZeroCopyStrings bool
+
+	// Reuse makes decoding into existing values reuse their memory: slices with enough
+	// capacity are truncated and decoded in place, and maps are cleared and refilled.
+	// Non-nil pointers are always reused, with or without this option.
+	//
+	// Values in reused memory are decoded over the old values, so unexported or ignored
+	// struct fields keep their old values.
+	Reuse bool
+}
+
+// NewDecoder returns a new decoder reading from r. See NewDecoderWithOptions.
+func NewDecoder(r io.Reader) *Decoder {
+	return NewDecoderWithOptions(r, DecoderOptions{})
+}
+
+// NewDecoderWithOptions returns a new decoder reading from r, with the given options.
+//
+// The decoder reads no data from r beyond the decoded values, so that r can be read further
+// after decoding. If r does not implement io.ByteReader, such as an os.File or a net.Conn,
+// it is read a few bytes at a time: wrap it in a bufio.Reader for speed, if reading ahead
+// is fine.
+func NewDecoderWithOptions(r io.Reader, opts DecoderOptions) *Decoder {
+	dr, ok := r.(decReader)
+	if !ok {
+		dr = &byteReader{r: r}
+	}
+	return newDecoder(dr, opts)
+}
+
+func newDecoder(r decReader, opts DecoderOptions) *Decoder {
+	if opts.Registry == nil {
+		opts.Registry = DefaultRegistry
+	}
+	return &Decoder{
+		r:     r,
+		opts:  opts,
+		enums: make(map[reflect.Type]map[string]map[EnumKeyType]reflect.Type),
+	}
+}
+
+// NewDecoderFromBytes returns a new decoder reading from in-memory data, with the given
+// options.
+func NewDecoderFromBytes(data []byte, opts DecoderOptions) *Decoder {
+	return newDecoder(&sliceReader{data: data}, opts)
+}
+
+func (d *Decoder) Decode(v interface{}) error {
+	if (d.opts.ZeroCopy || d.opts.ZeroCopyStrings) && !d.inMemory() {
+		return errors.New("zero copy decoding requires in-memory input")
+	}
+	err := d.decode(reflect.Indirect(reflect.ValueOf(v)), nil, nil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// inMemory returns whether the decoder reads from in-memory data.
+func (d *Decoder) inMemory() bool {
+	_, ok := d.r.(*sliceReader)
+	return ok
+}
+
+func (d *Decoder) EOF() bool {
+	_, err := d.r.ReadByte()
+	if err == io.EOF {
+		return true
+	}
+	return false
+}
+
+func (d *Decoder) decode(rv reflect.Value, enumVariants map[EnumKeyType]reflect.Type, tag *fieldTag) (err error) {
+	if !rv.IsValid() {
+		return errors.New("not supported kind: " + rv.Kind().String())
+	}
+	if tag.isOptional(rv.Kind()) {
+		if !rv.CanSet() {
+			return errors.New("optional value cannot set")
+		}
+		var present bool
+		if present, err = d.readBool(); err != nil {
+			return
+		}
+		if !present {
+			rv.Set(reflect.Zero(rv.Type()))
+			return
+		}
+		tag = tag.withoutOptional()
+	}
+	if c, ok := d.opts.Registry.codec(rv.Type()); ok {
+		if !rv.CanSet() {
+			return errors.New(rv.Type().String() + " value cannot set")
+		}
+		return c.decode(d, rv)
+	}
+	if c, ok := d.opts.Registry.codec(reflect.PtrTo(rv.Type())); ok {
+		if !rv.CanAddr() {
+			return errors.New(rv.Type().String() + " value cannot set")
+		}
+		p := reflect.New(reflect.PtrTo(rv.Type())).Elem()
+		p.Set(rv.Addr())
+		if err = c.decode(d, p); err != nil {
+			return
+		}
+		if p.IsNil() {
+			return errors.New(rv.Type().String() + " codec decoded nil pointer")
+		}
+		rv.Set(p.Elem())
+		return
+	}
+	if tag != nil && tag.enum != "" {
+		if enumVariants, err = d.enumVariants(tag); err != nil {
+			return
+		}
+	}
+	if count, ok := cEnumGetSize(rv.Type()); ok {
+		return d.decodeCEnum(rv, count)
+	}
+	if tag != nil && tag.uleb128 {
+		return d.decodeULEB128(rv)
+	}
+	if tag != nil && tag.width != "" {
+		return d.decodeWidthInt(rv, tag.width)
+	}
+	if tag != nil && tag.isSet {
+		return d.decodeSet(rv, enumVariants, tag)
+	}
+	if tag != nil && tag.isMap {
+		// entries are decoded in wire order, without checking the order of keys
+		if rv.Kind() != reflect.Slice {
+			return errors.New("map tag requires slice, got " + rv.Kind().String())
+		}
+		if _, _, err = mapEntryFields(rv.Type().Elem()); err != nil {
+			return
+		}
+		return d.decodeSlice(rv, nil, nil)
+	}
+	switch rv.Kind() {
+	case reflect.Bool:
+		if !rv.CanSet() {
+			return errors.New("bool value cannot set")
+		}
+		var b bool
+		if b, err = d.readBool(); err != nil {
+			return
+		}
+		rv.SetBool(b)
+	case /*reflect.Int,*/ reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		/*reflect.Uint,*/ reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if !rv.CanSet() {
+			return errors.New("integer value cannot set")
+		}
+		var u uint64
+		if u, err = d.readUint(int(rv.Type().Size())); err != nil {
+			return
+		}
+		if isUnsignedKind(rv.Kind()) {
+			rv.SetUint(u)
+		} else {
+			// sign extend
+			shift := uint(64 - 8*rv.Type().Size())
+			rv.SetInt(int64(u<<shift) >> shift)
+		}
+	case reflect.Slice:
+		err = d.decodeSlice(rv, enumVariants, tag)
+	case reflect.Array:
+		err = d.decodeArray(rv, enumVariants, tag)
+	case reflect.String:
+		err = d.decodeString(rv, tag.lenOf())
+	case reflect.Struct:
+		err = d.decodeStruct(rv)
+	case reflect.Map:
+		err = d.decodeMap(rv, tag)
+	case reflect.Ptr:
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		err = d.decode(rv.Elem(), enumVariants, tag)
+	case reflect.Interface:
+		err = d.decodeInterface(rv, enumVariants)
+	case reflect.Int, reflect.Uint, reflect.Uintptr:
+		err = errMissingWidthTag(rv.Kind())
+	default:
+		err = errors.New("not supported kind: " + rv.Kind().String())
+	}
+	return
+}
+
+func (d *Decoder) readBool() (bool, error) {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return false, err
+	}
+	switch b {
+	case 0:
+		return false, nil
+	case 1:
+		return true, nil
+	}
+	return false, errors.New("unexpected value for bool")
+}
+
+// readUint reads a little endian unsigned integer of size bytes, which should be at most 8.
+func (d *Decoder) readUint(size int) (uint64, error) {
+	var b []byte
+	if sr, ok := d.r.(*sliceReader); ok {
+		var err error
+		if b, err = sr.next(size); err != nil {
+			return 0, err
+		}
+	} else {
+		b = d.scratch[:size]
+		if _, err := io.ReadFull(d.r, b); err != nil {
+			return 0, err
+		}
+	}
+	var u uint64
+	for i := size - 1; i >= 0; i-- {
+		u = u<<8 | uint64(b[i])
+	}
+	return u, nil
+}
+
+// decodeByteSlice reads a byte slice. If alias is true and the input is in memory, the
+// returned slice aliases the input instead of being copied. Otherwise, buf is reused if it
+// has enough capacity.
+func (d *Decoder) decodeByteSlice(fixedLen int, alias bool, buf []byte) (b []byte, err error) {
+	l := uint32(fixedLen)
+	if l == 0 {
+		l1, err := readVarUint(d.r, 28)
+		if err != nil {
+			return nil, err
+		}
+		l = uint32(l1)
+		if l > maxByteSliceSize {
+			return nil, errors.New("byte slice longer than 100MB not supported")
+		}
+	}
+	var src []byte
+	if sr, ok := d.r.(*sliceReader); ok {
+		if src, err = sr.next(int(l)); err != nil {
+			return
+		}
+		if alias {
+			// limit the capacity, so that appending to b does not overwrite the input
+			return src[:l:l], nil
+		}
+	}
+	if buf != nil && cap(buf) >= int(l) {
+		b = buf[:l]
+	} else {
+		b = make([]byte, l)
+	}
+	if src != nil {
+		copy(b, src)
+		return
+	}
+	if _, err = io.ReadFull(d.r, b); err != nil {
+		return
+	}
+	return
+}
+
+func (d *Decoder) decodeSlice(rv reflect.Value, enumVariants map[EnumKeyType]reflect.Type, tag *fieldTag) (err error) {
+	fixedLen := tag.lenOf()
+	if !rv.CanSet() {
+		return errors.New("slice cannot set")
+	}
+	if rv.Type() == reflect.TypeOf([]byte{}) {
+		var b, buf []byte
+		if d.opts.Reuse {
+			buf = rv.Bytes()
+		}
+		if b, err = d.decodeByteSlice(fixedLen, d.opts.ZeroCopy, buf); err != nil {
+			return
+		}
+		rv.SetBytes(b)
+		return
+	}
+
+	l := fixedLen
+	if l == 0 {
+		l1, err := readVarUint(d.r, 28)
+		if err != nil {
+			return err
+		}
+		l = int(l1)
+	}
+	elemTag := tag.scope("elem", false)
+	bulk := isBulkElem(rv.Type().Elem(), elemTag, d.opts.Registry)
+
+	var s reflect.Value
+	if d.opts.Reuse && !rv.IsNil() && rv.Cap() >= l {
+		s = rv.Slice(0, l)
+	} else if bulk {
+		n, ok := d.remaining()
+		if !ok {
+			// the length is not known to be plausible, so grow the slice while decoding
+			if s, err = d.decodeBulkChunks(rv.Type(), l); err != nil {
+				return
+			}
+			rv.Set(s)
+			return
+		}
+		if l > n/int(rv.Type().Elem().Size()) {
+			return io.ErrUnexpectedEOF
+		}
+		s = reflect.MakeSlice(rv.Type(), l, l)
+	} else if cap := d.initCap(l); cap == l {
+		s = reflect.MakeSlice(rv.Type(), l, l)
+	} else {
+		// the length is not known to be plausible, so grow the slice while decoding
+		s = reflect.MakeSlice(rv.Type(), 0, cap)
+		for i := 0; i < l; i++ {
+			v := reflect.New(rv.Type().Elem())
+			if err = d.decode(v.Elem(), enumVariants, elemTag); err != nil {
+				return withIndex(err, i)
+			}
+			s = reflect.Append(s, v.Elem())
+		}
+		rv.Set(s)
+		return
+	}
+
+	if bulk {
+		if err = d.decodeBulk(s); err != nil {
+			return
+		}
+	} else {
+		for i := 0; i < l; i++ {
+			if err = d.decode(s.Index(i), enumVariants, elemTag); err != nil {
+				return withIndex(err, i)
+			}
+		}
+	}
+	rv.Set(s)
+	return
+}
+
+// initCap returns the initial capacity for a slice or map of l elements. It is l if the
+// remaining input is known to be long enough, assuming that each element takes at least
+// one byte. Otherwise it is limited, so that a corrupt length does not cause a large
+// allocation.
+func (d *Decoder) initCap(l int) int {
+	if n, ok := d.remaining(); ok && l <= n {
+		return l
+	}
+	if l > sliceAndMapInitSize {
+		return sliceAndMapInitSize
+	}
+	return l
+}
+
+// remaining returns the number of bytes left, if the input is in memory.
+func (d *Decoder) remaining() (int, bool) {
+	if sr, ok := d.r.(*sliceReader); ok {
+		return len(sr.data) - sr.off, true
+	}
+	return 0, false
+}
+
+// decodeSet decodes a slice encoded as a set, and verifies that the elements are sorted
+// by their encoded bytes without duplicates.
+func (d *Decoder) decodeSet(rv reflect.Value, enumVariants map[EnumKeyType]reflect.Type, tag *fieldTag) (err error) {
+	if rv.Kind() != reflect.Slice {
+		return errors.New("set tag requires slice, got " + rv.Kind().String())
+	}
+	if !rv.CanSet() {
+		return errors.New("slice cannot set")
+	}
+	l1, err := readVarUint(d.r, 28)
+	if err != nil {
+		return
+	}
+	l := int(l1)
+	cap := l
+	if cap > sliceAndMapInitSize {
+		cap = sliceAndMapInitSize
+	}
+	elemTag := tag.scope("elem", false)
+	s := reflect.MakeSlice(rv.Type(), 0, cap)
+	var prev []byte
+	for i := 0; i < l; i++ {
+		v := reflect.New(rv.Type().Elem())
+		b, err := d.decodeRecorded(v.Elem(), enumVariants, elemTag)
+		if err != nil {
+			return withIndex(err, i)
+		}
+		if i > 0 && bytes.Compare(prev, b) >= 0 {
+			return errors.New("set elements not in canonical order or duplicated")
+		}
+		prev = b
+		s = reflect.Append(s, v.Elem())
+	}
+	rv.Set(s)
+	return
+}
+
+// decodeRecorded decodes rv, and returns the bytes it consumed.
+func (d *Decoder) decodeRecorded(rv reflect.Value, enumVariants map[EnumKeyType]reflect.Type, tag *fieldTag) ([]byte, error) {
+	if sr, ok := d.r.(*sliceReader); ok {
+		start := sr.off
+		if err := d.decode(rv, enumVariants, tag); err != nil {
+			return nil, err
+		}
+		return sr.data[start:sr.off], nil
+	}
+	var b bytes.Buffer
+	r := d.r
+	d.r = &teeReader{r: r, w: &b}
+	defer func() { d.r = r }()
+	if err := d.decode(rv, enumVariants, tag); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (d *Decoder) decodeMap(rv reflect.Value, tag *fieldTag) (err error) {
+	if !rv.CanSet() {
+		return errors.New("map cannot set")
+	}
+
+	l1, err := readVarUint(d.r, 28)
+	if err != nil {
+		return
+	}
+	l := int(l1)
+	keyTag, valueTag := tag.scope("key", false), tag.scope("value", false)
+	isSet := isSetMap(rv.Type())
+	var prev []byte
+	var m reflect.Value
+	if d.opts.Reuse && !rv.IsNil() {
+		m = rv
+		for iter := m.MapRange(); iter.Next(); {
+			m.SetMapIndex(iter.Key(), reflect.Value{})
+		}
+	} else {
+		m = reflect.MakeMapWithSize(rv.Type(), d.initCap(l))
+	}
+	for i := 0; i < l; i++ {
+		k := reflect.New(rv.Type().Key())
+		v := reflect.New(rv.Type().Elem())
+		if isSet {
+			var kb []byte
+			if kb, err = d.decodeRecorded(k.Elem(), nil, keyTag); err != nil {
+				return withKey(err, k.Elem(), keyTag, d.opts.Registry)
+			}
+			if i > 0 && bytes.Compare(prev, kb) >= 0 {
+				return errors.New("set elements not in canonical order or duplicated")
+			}
+			prev = kb
+		} else if err = d.decode(k.Elem(), nil, keyTag); err != nil {
+			return withKey(err, k.Elem(), keyTag, d.opts.Registry)
+		}
+		if err = d.decode(v.Elem(), nil, valueTag); err != nil {
+			return withKey(err, k.Elem(), keyTag, d.opts.Registry)
+		}
+		m.SetMapIndex(k.Elem(), v.Elem())
+	}
+	rv.Set(m)
+	return
+}
+
+func (d *Decoder) decodeArray(rv reflect.Value, enumVariants map[EnumKeyType]reflect.Type, tag *fieldTag) (err error) {
+	if !rv.CanSet() {
+		return errors.New("array cannot set")
+	}
+	fixedLen := rv.Len()
+	if rv.Type().Elem() == reflect.TypeOf(byte(0)) {
+		var b []byte
+		// the bytes are copied into the array, so they can alias the input
+		if b, err = d.decodeByteSlice(fixedLen, true, nil); err != nil {
+			return
+		}
+		if len(b) != rv.Len() {
+			return errors.New("length mismatch")
+		}
+		reflect.Copy(rv, reflect.ValueOf(b))
+		return
+	}
+
+	l := uint32(fixedLen)
+	if l == 0 {
+		l1, err := readVarUint(d.r, 28)
+		if err != nil {
+			return err
+		}
+		l = uint32(l1)
+	}
+	if int(l) != rv.Len() {
+		return errors.New("length mismatch")
+	}
+	elemTag := tag.scope("elem", false)
+	if isBulkElem(rv.Type().Elem(), elemTag, d.opts.Registry) {
+		return d.decodeBulk(rv.Slice(0, rv.Len()))
+	}
+	for i := 0; i < int(l); i++ {
+		if err = d.decode(rv.Index(i), enumVariants, elemTag); err != nil {
+			return withIndex(err, i)
+		}
+	}
+	return
+}
+
+func (d *Decoder) decodeString(rv reflect.Value, fixedLen int) (err error) {
+	if !rv.CanSet() {
+		return errors.New("string cannot set")
+	}
+	var b []byte
+	// string(b) copies the bytes, so they can alias the input
+	if b, err = d.decodeByteSlice(fixedLen, true, nil); err != nil {
+		return
+	}
+	if d.opts.ZeroCopyStrings && d.inMemory() {
+		rv.SetString(bytesToString(b))
+	} else {
+		rv.SetString(string(b))
+	}
+	return
+}
+
+func (d *Decoder) decodeInterface(rv reflect.Value, enumVariants map[EnumKeyType]reflect.Type) (err error) {
+	typeVal, err := readVarUint(d.r, 28)
+	if err != nil {
+		return
+	}
+	tpl, ok := enumGetTypeByIdx(rv.Type(), typeVal)
+	if !ok {
+		tpl, ok = enumVariants[typeVal]
+		if !ok {
+			return fmt.Errorf("enum variant value %d unknown for interface: %s", typeVal, rv.Type())
+		}
+	}
+	if tpl.Kind() == reflect.Ptr {
+		rv1 := reflect.New(tpl.Elem())
+		if err = d.decode(rv1, nil, nil); err != nil {
+			return
+		}
+		rv.Set(rv1)
+	} else {
+		rv1 := reflect.New(tpl)
+		if err = d.decode(rv1, nil, nil); err != nil {
+			return
+		}
+		rv.Set(rv1.Elem())
+	}
+	return nil
+}
+
+func (d *Decoder) decodeULEB128(rv reflect.Value) (err error) {
+	if !isUnsignedKind(rv.Kind()) {
+		return errors.New("uleb128 tag requires unsigned integer, got " + rv.Kind().String())
+	}
+	if !rv.CanSet() {
+		return errors.New("integer value cannot set")
+	}
+	v, err := readVarUint(d.r, uint(rv.Type().Bits()))
+	if err != nil {
+		return
+	}
+	rv.SetUint(v)
+	return
+}
+
+func (d *Decoder) decodeWidthInt(rv reflect.Value, width string) (err error) {
+	if !isIntegerKind(rv.Kind()) {
+		return errors.New(width + " tag requires integer, got " + rv.Kind().String())
+	}
+	if !rv.CanSet() {
+		return errors.New("integer value cannot set")
+	}
+	w := intWidthTags[width]
+	u, err := d.readUint(w.bits / 8)
+	if err != nil {
+		return
+	}
+	if w.signed {
+		// sign extend
+		v := int64(u<<uint(64-w.bits)) >> uint(64-w.bits)
+		if isSignedKind(rv.Kind()) && !rv.OverflowInt(v) {
+			rv.SetInt(v)
+			return
+		}
+		if !isSignedKind(rv.Kind()) && v >= 0 && !rv.OverflowUint(uint64(v)) {
+			rv.SetUint(uint64(v))
+			return
+		}
+		return fmt.Errorf("value %d overflows %s", v, rv.Type())
+	}
+	if isSignedKind(rv.Kind()) && u <= 1<<63-1 && !rv.OverflowInt(int64(u)) {
+		rv.SetInt(int64(u))
+		return
+	}
+	if !isSignedKind(rv.Kind()) && !rv.OverflowUint(u) {
+		rv.SetUint(u)
+		return
+	}
+	return fmt.Errorf("value %d overflows %s", u, rv.Type())
+}
+
+func (d *Decoder) decodeCEnum(rv reflect.Value, count EnumKeyType) (err error) {
+	if !rv.CanSet() {
+		return errors.New("enum value cannot set")
+	}
+	v, err := readVarUint(d.r, 64)
+	if err != nil {
+		return
+	}
+	if v >= count {
+		return fmt.Errorf("enum %s discriminant %d out of range [0, %d)", rv.Type(), v, count)
+	}
+	if isSignedKind(rv.Kind()) {
+		rv.SetInt(int64(v))
+	} else {
+		rv.SetUint(v)
+	}
+	return
+}
+
+func (d *Decoder) decodeStruct(rv reflect.Value) (err error) {
+	if !rv.CanSet() {
+		return errors.New("struct cannot set")
+	}
+	fields, err := structFields(rv.Type())
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if err = d.decode(rv.Field(f.index), nil, f.tag); err != nil {
+			return withPath(err, rv.Type().Field(f.index).Name)
+		}
+	}
+	return validate(rv)
+}
+
+// enumVariants returns the variants of the enum named in tag, defined by the struct which
+// declares the field.
+func (d *Decoder) enumVariants(tag *fieldTag) (map[EnumKeyType]reflect.Type, error) {
+	evsAll, ok := d.enums[tag.owner]
+	if !ok {
+		if evsAll = enumVariantsByIdx(tag.owner); evsAll != nil {
+			d.enums[tag.owner] = evsAll
+		}
+	}
+	if evsAll == nil {
+		return nil, fmt.Errorf("struct (%s) does not implement EnumTypeUser", tag.owner)
+	}
+	evs, ok := evsAll[tag.enum]
+	if !ok {
+		return nil, errors.New("enum variants not defined for enum name: " + tag.enum)
+	}
+	return evs, nil
+}
+
+// enumVariantsByIdx returns the variants of the enums defined by rt, which implements
+// EnumTypeUser, by enum names and values. It returns nil if rt does not implement it.
+func enumVariantsByIdx(rt reflect.Type) map[string]map[EnumKeyType]reflect.Type {
+	vv, ok := reflect.Zero(rt).Interface().(EnumTypeUser)
+	if !ok {
+		vv, ok = reflect.Zero(reflect.PtrTo(rt)).Interface().(EnumTypeUser)
+		if !ok {
+			return nil
+		}
+	}
+	r := make(map[string]map[EnumKeyType]reflect.Type)
+	evs := vv.EnumTypes()
+	for _, ev := range evs {
+		evt := reflect.TypeOf(ev.Template)
+		if r[ev.Name] == nil {
+			r[ev.Name] = make(map[EnumKeyType]reflect.Type)
+		}
+		r[ev.Name][ev.Value] = evt
+	}
+	return r
+}
+
+func Unmarshal(data []byte, v interface{}) error {
+	return UnmarshalWithOptions(data, v, DecoderOptions{})
+}
+
+// UnmarshalWithOptions decodes data into v, with the given options.
+func UnmarshalWithOptions(data []byte, v interface{}, opts DecoderOptions) error {
+	d := NewDecoderFromBytes(data, opts)
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	if !d.EOF() {
+		return errors.New("unexpected data")
+	}
+	return nil
+}
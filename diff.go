@@ -0,0 +1,204 @@
+package lcs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// DiffKind is the kind of a Difference.
+type DiffKind int
+
+const (
+	// DiffChanged is a value which changed.
+	DiffChanged DiffKind = iota
+	// DiffAdded is a value only in the second blob, such as an added map key.
+	DiffAdded
+	// DiffRemoved is a value only in the first blob, such as a removed map key.
+	DiffRemoved
+	// DiffLen is a slice or map whose length changed.
+	DiffLen
+	// DiffVariant is an enum value whose variant changed.
+	DiffVariant
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case DiffChanged:
+		return "changed"
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffLen:
+		return "length changed"
+	case DiffVariant:
+		return "variant changed"
+	}
+	return fmt.Sprintf("DiffKind(%d)", int(k))
+}
+
+// Difference is a difference between two encoded values, found by Diff.
+type Difference struct {
+	Kind DiffKind
+	// Path is the path of the value, which is empty for the root value.
+	Path string
+	// OffsetA and OffsetB are the offsets of the value in each blob, or -1 if it is missing.
+	// For DiffLen and DiffVariant, they are the offsets of the length or the discriminant.
+	OffsetA, OffsetB int
+	// A and B are the values in each blob: the decoded values for DiffChanged, the lengths
+	// for DiffLen and the discriminants for DiffVariant. They are nil otherwise.
+	A, B interface{}
+}
+
+func (d Difference) String() string {
+	path := d.Path
+	if path == "" {
+		path = "."
+	}
+	s := fmt.Sprintf("%s %s at %s/%s", d.Kind, path, formatOffset(d.OffsetA), formatOffset(d.OffsetB))
+	if d.A != nil || d.B != nil {
+		s += fmt.Sprintf(": %s -> %s", formatValue(reflect.ValueOf(d.A)), formatValue(reflect.ValueOf(d.B)))
+	}
+	return s
+}
+
+func formatOffset(off int) string {
+	if off < 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%#x", off)
+}
+
+// Diff compares two encoded values of type typ, and returns the paths of the values which
+// differ. See DiffWithOptions.
+func Diff(a, b []byte, typ reflect.Type) ([]Difference, error) {
+	return DiffWithOptions(a, b, typ, DecoderOptions{})
+}
+
+// DiffWithOptions compares two encoded values of type typ with the given options, and returns
+// the paths of the values which differ, in the order of a, followed by the values only in b.
+//
+// Map entries and slice elements only in one blob are reported as added or removed, along
+// with the changed length. The values inside added, removed or changed enum variants and
+// optional values are not reported separately.
+func DiffWithOptions(a, b []byte, typ reflect.Type, opts DecoderOptions) ([]Difference, error) {
+	spansA, err := diffSpans(a, typ, opts)
+	if err != nil {
+		return nil, fmt.Errorf("first value: %v", err)
+	}
+	spansB, err := diffSpans(b, typ, opts)
+	if err != nil {
+		return nil, fmt.Errorf("second value: %v", err)
+	}
+	indexA, indexB := spanIndex(spansA), spanIndex(spansB)
+
+	var diffs []Difference
+	// spans are in order, so the spans inside a skipped value follow it
+	skipped, skipping := "", false
+	// reported are the values in both blobs whose parts are not compared
+	reported := make(map[string]bool)
+	skip := func(path string) bool {
+		return skipping && isPathWithin(path, skipped)
+	}
+	for _, sa := range spansA {
+		if sa.label != "" && sa.label != "len" || skip(sa.path) {
+			continue
+		}
+		sb, ok := indexB[sa.label+"\x00"+sa.path]
+		if !ok {
+			if sa.label == "" {
+				diffs = append(diffs, Difference{Kind: DiffRemoved, Path: sa.path, OffsetA: sa.start, OffsetB: -1})
+				skipped, skipping = sa.path, true
+			}
+			continue
+		}
+		if sa.label == "len" {
+			if sa.value.Int() != sb.value.Int() {
+				diffs = append(diffs, Difference{Kind: DiffLen, Path: sa.path, OffsetA: sa.start, OffsetB: sb.start,
+					A: sa.value.Interface(), B: sb.value.Interface()})
+			}
+			continue
+		}
+		// the presence and variant of a value are parts which follow it, so they are looked
+		// up by path, and decide whether the rest of its parts are compared
+		oa, ob := indexA["optional\x00"+sa.path], indexB["optional\x00"+sa.path]
+		if oa != nil && ob != nil && oa.value.Bool() != ob.value.Bool() {
+			kind := DiffRemoved
+			if ob.value.Bool() {
+				kind = DiffAdded
+			}
+			diffs = append(diffs, Difference{Kind: kind, Path: sa.path, OffsetA: sa.start, OffsetB: sb.start})
+			skipped, skipping = sa.path, true
+			reported[sa.path] = true
+			continue
+		}
+		va, vb := indexA["variant\x00"+sa.path], indexB["variant\x00"+sa.path]
+		if va != nil && vb != nil && va.value.Uint() != vb.value.Uint() {
+			diffs = append(diffs, Difference{Kind: DiffVariant, Path: sa.path, OffsetA: va.start, OffsetB: vb.start,
+				A: va.value.Interface(), B: vb.value.Interface()})
+			skipped, skipping = sa.path, true
+			reported[sa.path] = true
+			continue
+		}
+		if sa.leaf && !bytes.Equal(a[sa.start:sa.end], b[sb.start:sb.end]) {
+			diffs = append(diffs, Difference{Kind: DiffChanged, Path: sa.path, OffsetA: sa.start, OffsetB: sb.start,
+				A: sa.value.Interface(), B: sb.value.Interface()})
+		}
+	}
+	skipping = false
+	for _, sb := range spansB {
+		if sb.label != "" || skip(sb.path) {
+			continue
+		}
+		if reported[sb.path] {
+			skipped, skipping = sb.path, true
+			continue
+		}
+		if indexA["\x00"+sb.path] != nil {
+			continue
+		}
+		diffs = append(diffs, Difference{Kind: DiffAdded, Path: sb.path, OffsetA: -1, OffsetB: sb.start})
+		skipped, skipping = sb.path, true
+	}
+	return diffs, nil
+}
+
+// diffSpans walks data, and returns its spans in order.
+func diffSpans(data []byte, typ reflect.Type, opts DecoderOptions) ([]*walkSpan, error) {
+	var spans []*walkSpan
+	w := newWalker(data, opts, true, func(s *walkSpan) error {
+		spans = append(spans, s)
+		return nil
+	})
+	if err := w.walk(typ, "", nil, nil, 0); err != nil {
+		return nil, err
+	}
+	if w.sr.off != len(data) {
+		return nil, errors.New("unexpected data")
+	}
+	sortSpans(spans)
+	return spans, nil
+}
+
+// spanIndex returns the spans by their labels and paths.
+func spanIndex(spans []*walkSpan) map[string]*walkSpan {
+	m := make(map[string]*walkSpan, len(spans))
+	for _, s := range spans {
+		m[s.label+"\x00"+s.path] = s
+	}
+	return m
+}
+
+// isPathWithin returns whether path is p or a path inside it.
+func isPathWithin(path, p string) bool {
+	if !strings.HasPrefix(path, p) {
+		return false
+	}
+	if len(path) == len(p) {
+		return true
+	}
+	return p == "" || path[len(p)] == '.' || path[len(p)] == '['
+}
@@ -1,215 +1,453 @@
-package lcs
-
-import (
-	"bufio"
-	"bytes"
-	"encoding/binary"
-	"errors"
-	"io"
-	"reflect"
-	"sort"
-	"strconv"
-)
-
-type Encoder struct {
-	w     *bufio.Writer
-	enums map[reflect.Type]map[string]map[reflect.Type]EnumKeyType
-}
-
-func NewEncoder(w io.Writer) *Encoder {
-	return &Encoder{
-		w:     bufio.NewWriter(w),
-		enums: make(map[reflect.Type]map[string]map[reflect.Type]EnumKeyType),
-	}
-}
-
-func (e *Encoder) Encode(v interface{}) error {
-	if err := e.encode(reflect.Indirect(reflect.ValueOf(v)), nil, 0); err != nil {
-		return err
-	}
-	e.w.Flush()
-	return nil
-}
-
-func (e *Encoder) encode(rv reflect.Value, enumVariants map[reflect.Type]EnumKeyType, fixedLen int) (err error) {
-	// rv = indirect(rv)
-	switch rv.Kind() {
-	case reflect.Bool,
-		/*reflect.Int,*/ reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
-		/*reflect.Uint,*/ reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		err = binary.Write(e.w, binary.LittleEndian, rv.Interface())
-	case reflect.Slice, reflect.Array, reflect.String:
-		err = e.encodeSlice(rv, enumVariants, fixedLen)
-	case reflect.Struct:
-		err = e.encodeStruct(rv)
-	case reflect.Map:
-		err = e.encodeMap(rv)
-	case reflect.Ptr:
-		err = e.encode(rv.Elem(), enumVariants, 0)
-	case reflect.Interface:
-		err = e.encodeInterface(rv, enumVariants)
-	default:
-		err = errors.New("not supported kind: " + rv.Kind().String())
-	}
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func (e *Encoder) encodeSlice(rv reflect.Value, enumVariants map[reflect.Type]EnumKeyType, fixedLen int) (err error) {
-	if rv.Kind() == reflect.Array {
-		// ignore fixedLen
-	} else if fixedLen == 0 {
-		if _, err := writeVarUint(e.w, uint64(rv.Len())); err != nil {
-			return err
-		}
-	} else if fixedLen != rv.Len() {
-		return errors.New("actual len not equal to fixed len")
-	}
-	for i := 0; i < rv.Len(); i++ {
-		item := rv.Index(i)
-		if err = e.encode(item, enumVariants, 0); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func (e *Encoder) encodeInterface(rv reflect.Value, enumVariants map[reflect.Type]EnumKeyType) (err error) {
-	if rv.IsNil() {
-		return errors.New("non-optional enum value is nil")
-	}
-
-	ev, ok := enumGetIdxByType(rv.Type(), rv.Elem().Type())
-	rvReal := rv.Elem()
-	if !ok {
-		ev, ok = enumVariants[rvReal.Type()]
-		if !ok {
-			return errors.New("enum " + rv.Type().String() + " does not have variant of type " + rvReal.Type().String())
-		}
-	}
-	if _, err = writeVarUint(e.w, ev); err != nil {
-		return
-	}
-	if err = e.encode(rvReal, nil, 0); err != nil {
-		return err
-	}
-	return nil
-}
-
-func (e *Encoder) encodeStruct(rv reflect.Value) (err error) {
-	rt := rv.Type()
-	for i := 0; i < rv.NumField(); i++ {
-		fv := rv.Field(i)
-		if !fv.CanInterface() {
-			continue
-		}
-		if rt.Field(i).Tag.Get(lcsTagName) == "-" {
-			continue
-		}
-		tag := parseTag(rt.Field(i).Tag.Get(lcsTagName))
-
-		var evs map[reflect.Type]EnumKeyType
-		if enumName, ok := tag["enum"]; ok {
-			evsAll, ok := e.enums[rv.Type()]
-			if !ok {
-				if evsAll = e.getEnumVariants(rv); evsAll != nil {
-					e.enums[rv.Type()] = evsAll
-				}
-			}
-			if evsAll == nil {
-				return errors.New("enum variants not defined")
-			}
-			evs, ok = evsAll[enumName]
-			if !ok {
-				return errors.New("enum variants not defined for enum name: " + enumName)
-			}
-		}
-
-		if _, ok := tag["optional"]; ok &&
-			(fv.Kind() == reflect.Ptr ||
-				fv.Kind() == reflect.Slice ||
-				fv.Kind() == reflect.Map ||
-				fv.Kind() == reflect.Interface) {
-			if err = e.encode(reflect.ValueOf(!fv.IsNil()), nil, 0); err != nil {
-				return err
-			}
-			if fv.IsNil() {
-				continue
-			}
-		}
-		fixedLen := 0
-		if fixedLenStr, ok := tag["len"]; ok && (fv.Kind() == reflect.Slice || fv.Kind() == reflect.String) {
-			fixedLen, err = strconv.Atoi(fixedLenStr)
-			if err != nil {
-				return errors.New("tag len parse error: " + err.Error())
-			}
-		}
-		if err = e.encode(fv, evs, fixedLen); err != nil {
-			return
-		}
-	}
-	return nil
-}
-
-func (e *Encoder) encodeMap(rv reflect.Value) (err error) {
-	_, err = writeVarUint(e.w, uint64(rv.Len()))
-	if err != nil {
-		return err
-	}
-
-	keys := make([]string, 0, rv.Len())
-	marshaledMap := make(map[string][]byte)
-	for iter := rv.MapRange(); iter.Next(); {
-		k := iter.Key()
-		v := iter.Value()
-		kb, err := Marshal(k.Interface())
-		if err != nil {
-			return err
-		}
-		vb, err := Marshal(v.Interface())
-		if err != nil {
-			return err
-		}
-		keys = append(keys, string(kb))
-		marshaledMap[string(kb)] = vb
-	}
-
-	sort.Strings(keys)
-	for _, k := range keys {
-		e.w.Write([]byte(k))
-		e.w.Write(marshaledMap[k])
-	}
-
-	return nil
-}
-
-func (e *Encoder) getEnumVariants(rv reflect.Value) map[string]map[reflect.Type]EnumKeyType {
-	vv, ok := rv.Interface().(EnumTypeUser)
-	if !ok {
-		vv, ok = reflect.New(reflect.PtrTo(rv.Type())).Elem().Interface().(EnumTypeUser)
-		if !ok {
-			return nil
-		}
-	}
-	r := make(map[string]map[reflect.Type]EnumKeyType)
-	evs := vv.EnumTypes()
-	for _, ev := range evs {
-		evt := reflect.TypeOf(ev.Template)
-		if r[ev.Name] == nil {
-			r[ev.Name] = make(map[reflect.Type]EnumKeyType)
-		}
-		r[ev.Name][evt] = ev.Value
-	}
-	return r
-}
-
-func Marshal(v interface{}) ([]byte, error) {
-	var b bytes.Buffer
-	e := NewEncoder(&b)
-	if err := e.Encode(v); err != nil {
-		return nil, err
-	}
-	return b.Bytes(), nil
-}
+package lcs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+type Encoder struct {
+	w     encWriter
+	opts  EncoderOptions
+	enums map[reflect.Type]map[string]map[reflect.Type]EnumKeyType
+
+	// sub encodes map entries and set elements into subBuf, before they are sorted.
+	// It is reused by all maps and sets at the same nesting level.
+	sub    *Encoder
+	subBuf *bytes.Buffer
+
+	scratch [8]byte
+}
+
+type encWriter interface {
+	io.Writer
+	io.ByteWriter
+}
+
+// EncoderOptions are the options of an Encoder.
+type EncoderOptions struct {
+	// Registry holds the custom codecs. DefaultRegistry is used if it is nil.
+	Registry *Registry
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return NewEncoderWithOptions(w, EncoderOptions{})
+}
+
+// NewEncoderWithOptions returns a new encoder writing to w, with the given options.
+func NewEncoderWithOptions(w io.Writer, opts EncoderOptions) *Encoder {
+	if opts.Registry == nil {
+		opts.Registry = DefaultRegistry
+	}
+	return &Encoder{
+		w:     bufio.NewWriter(w),
+		opts:  opts,
+		enums: make(map[reflect.Type]map[string]map[reflect.Type]EnumKeyType),
+	}
+}
+
+func (e *Encoder) Encode(v interface{}) error {
+	if err := checkBareVariant(reflect.TypeOf(v)); err != nil {
+		return err
+	}
+	if err := e.encode(reflect.Indirect(reflect.ValueOf(v)), nil, nil); err != nil {
+		return err
+	}
+	return e.flush()
+}
+
+// flush writes any buffered data to the underlying writer.
+func (e *Encoder) flush() error {
+	if bw, ok := e.w.(*bufio.Writer); ok {
+		return bw.Flush()
+	}
+	return nil
+}
+
+func (e *Encoder) encode(rv reflect.Value, enumVariants map[reflect.Type]EnumKeyType, tag *fieldTag) (err error) {
+	// rv = indirect(rv)
+	if !rv.IsValid() {
+		return errors.New("not supported kind: " + rv.Kind().String())
+	}
+	if tag.isOptional(rv.Kind()) {
+		if err = e.writeBool(!rv.IsNil()); err != nil {
+			return err
+		}
+		if rv.IsNil() {
+			return nil
+		}
+		tag = tag.withoutOptional()
+	}
+	if c, ok := e.opts.Registry.codec(rv.Type()); ok {
+		return c.encode(e, rv)
+	}
+	if c, ok := e.opts.Registry.codec(reflect.PtrTo(rv.Type())); ok {
+		if !rv.CanAddr() {
+			// the codec takes a pointer, so it encodes an addressable copy
+			v := reflect.New(rv.Type()).Elem()
+			v.Set(rv)
+			rv = v
+		}
+		return c.encode(e, rv.Addr())
+	}
+	if tag != nil && tag.enum != "" {
+		if enumVariants, err = e.enumVariants(tag); err != nil {
+			return err
+		}
+	}
+	if count, ok := cEnumGetSize(rv.Type()); ok {
+		return e.encodeCEnum(rv, count)
+	}
+	if tag != nil && tag.uleb128 {
+		return e.encodeULEB128(rv)
+	}
+	if tag != nil && tag.width != "" {
+		return e.encodeWidthInt(rv, tag.width)
+	}
+	if tag != nil && tag.isSet {
+		return e.encodeSet(rv, enumVariants, tag)
+	}
+	if tag != nil && tag.isMap {
+		return e.encodeEntries(rv, tag)
+	}
+	switch rv.Kind() {
+	case reflect.Bool:
+		err = e.writeBool(rv.Bool())
+	case /*reflect.Int,*/ reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		err = e.writeUint(uint64(rv.Int()), int(rv.Type().Size()))
+	case /*reflect.Uint,*/ reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		err = e.writeUint(rv.Uint(), int(rv.Type().Size()))
+	case reflect.Slice, reflect.Array, reflect.String:
+		err = e.encodeSlice(rv, enumVariants, tag)
+	case reflect.Struct:
+		err = e.encodeStruct(rv)
+	case reflect.Map:
+		err = e.encodeMap(rv, tag)
+	case reflect.Ptr:
+		err = e.encode(rv.Elem(), enumVariants, tag)
+	case reflect.Interface:
+		err = e.encodeInterface(rv, enumVariants)
+	case reflect.Int, reflect.Uint, reflect.Uintptr:
+		err = errMissingWidthTag(rv.Kind())
+	default:
+		err = errors.New("not supported kind: " + rv.Kind().String())
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (e *Encoder) writeBool(b bool) error {
+	if b {
+		return e.w.WriteByte(1)
+	}
+	return e.w.WriteByte(0)
+}
+
+// writeUint writes the lower size bytes of u in little endian.
+func (e *Encoder) writeUint(u uint64, size int) error {
+	binary.LittleEndian.PutUint64(e.scratch[:], u)
+	_, err := e.w.Write(e.scratch[:size])
+	return err
+}
+
+func (e *Encoder) encodeSlice(rv reflect.Value, enumVariants map[reflect.Type]EnumKeyType, tag *fieldTag) (err error) {
+	fixedLen := tag.lenOf()
+	if rv.Kind() == reflect.Array {
+		// ignore fixedLen
+	} else if fixedLen == 0 {
+		if _, err := writeVarUint(e.w, uint64(rv.Len())); err != nil {
+			return err
+		}
+	} else if fixedLen != rv.Len() {
+		return errors.New("actual len not equal to fixed len")
+	}
+	elemTag := tag.scope("elem", false)
+	if rv.Kind() == reflect.String || isBulkElem(rv.Type().Elem(), elemTag, e.opts.Registry) {
+		return e.encodeBulk(rv)
+	}
+	for i := 0; i < rv.Len(); i++ {
+		item := rv.Index(i)
+		if err = e.encode(item, enumVariants, elemTag); err != nil {
+			return withIndex(err, i)
+		}
+	}
+	return nil
+}
+
+// encodeSet encodes a slice as a set: elements are sorted by their encoded bytes, and
+// duplicates are removed.
+func (e *Encoder) encodeSet(rv reflect.Value, enumVariants map[reflect.Type]EnumKeyType, tag *fieldTag) (err error) {
+	if rv.Kind() != reflect.Slice {
+		return errors.New("set tag requires slice, got " + rv.Kind().String())
+	}
+	elemTag := tag.scope("elem", false)
+	return e.encodeSorted(rv.Len(), true,
+		func(sub *Encoder, i int) error {
+			return withIndex(sub.encode(rv.Index(i), enumVariants, elemTag), i)
+		}, nil)
+}
+
+func (e *Encoder) encodeInterface(rv reflect.Value, enumVariants map[reflect.Type]EnumKeyType) (err error) {
+	if rv.IsNil() {
+		return errors.New("non-optional enum value is nil")
+	}
+
+	ev, ok := enumGetIdxByType(rv.Type(), rv.Elem().Type())
+	rvReal := rv.Elem()
+	if !ok {
+		ev, ok = enumVariants[rvReal.Type()]
+		if !ok {
+			return errors.New("enum " + rv.Type().String() + " does not have variant of type " + rvReal.Type().String())
+		}
+	}
+	if _, err = writeVarUint(e.w, ev); err != nil {
+		return
+	}
+	if err = e.encode(rvReal, nil, nil); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (e *Encoder) encodeStruct(rv reflect.Value) (err error) {
+	fields, err := structFields(rv.Type())
+	if err != nil {
+		return err
+	}
+	if rv, err = beforeEncode(rv); err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if err = e.encode(rv.Field(f.index), nil, f.tag); err != nil {
+			return withPath(err, rv.Type().Field(f.index).Name)
+		}
+	}
+	return nil
+}
+
+// enumVariants returns the variants of the enum named in tag, defined by the struct which
+// declares the field.
+func (e *Encoder) enumVariants(tag *fieldTag) (map[reflect.Type]EnumKeyType, error) {
+	evsAll, ok := e.enums[tag.owner]
+	if !ok {
+		if evsAll = e.getEnumVariants(tag.owner); evsAll != nil {
+			e.enums[tag.owner] = evsAll
+		}
+	}
+	if evsAll == nil {
+		return nil, errors.New("enum variants not defined")
+	}
+	evs, ok := evsAll[tag.enum]
+	if !ok {
+		return nil, errors.New("enum variants not defined for enum name: " + tag.enum)
+	}
+	return evs, nil
+}
+
+func (e *Encoder) encodeULEB128(rv reflect.Value) (err error) {
+	if !isUnsignedKind(rv.Kind()) {
+		return errors.New("uleb128 tag requires unsigned integer, got " + rv.Kind().String())
+	}
+	_, err = writeVarUint(e.w, rv.Uint())
+	return
+}
+
+func (e *Encoder) encodeWidthInt(rv reflect.Value, width string) (err error) {
+	if !isIntegerKind(rv.Kind()) {
+		return errors.New(width + " tag requires integer, got " + rv.Kind().String())
+	}
+	w := intWidthTags[width]
+	var u uint64
+	if isSignedKind(rv.Kind()) {
+		v := rv.Int()
+		if w.signed && (v < -1<<uint(w.bits-1) || v > 1<<uint(w.bits-1)-1) ||
+			!w.signed && (v < 0 || w.bits < 64 && uint64(v) >= 1<<uint(w.bits)) {
+			return fmt.Errorf("value %d overflows %s", v, width)
+		}
+		u = uint64(v)
+	} else {
+		u = rv.Uint()
+		if w.signed && u > 1<<uint(w.bits-1)-1 ||
+			!w.signed && w.bits < 64 && u >= 1<<uint(w.bits) {
+			return fmt.Errorf("value %d overflows %s", u, width)
+		}
+	}
+	return e.writeUint(u, w.bits/8)
+}
+
+func (e *Encoder) encodeCEnum(rv reflect.Value, count EnumKeyType) (err error) {
+	var v uint64
+	if isSignedKind(rv.Kind()) {
+		if rv.Int() < 0 {
+			return fmt.Errorf("enum %s value %d out of range [0, %d)", rv.Type(), rv.Int(), count)
+		}
+		v = uint64(rv.Int())
+	} else {
+		v = rv.Uint()
+	}
+	if v >= count {
+		return fmt.Errorf("enum %s value %d out of range [0, %d)", rv.Type(), v, count)
+	}
+	_, err = writeVarUint(e.w, v)
+	return
+}
+
+func (e *Encoder) encodeMap(rv reflect.Value, tag *fieldTag) (err error) {
+	keyTag, valueTag := tag.scope("key", false), tag.scope("value", false)
+	iter := rv.MapRange()
+	return e.encodeSorted(rv.Len(), false,
+		func(sub *Encoder, i int) error {
+			iter.Next()
+			if err := sub.encode(iter.Key(), nil, keyTag); err != nil {
+				return withKey(err, iter.Key(), keyTag, e.opts.Registry)
+			}
+			return nil
+		},
+		func(sub *Encoder, i int) error {
+			if err := sub.encode(iter.Value(), nil, valueTag); err != nil {
+				return withKey(err, iter.Key(), keyTag, e.opts.Registry)
+			}
+			return nil
+		})
+}
+
+// encodeEntries encodes a slice of key-value structs as a map: entries are sorted by the
+// encoded bytes of their keys, and duplicated keys are rejected.
+func (e *Encoder) encodeEntries(rv reflect.Value, tag *fieldTag) (err error) {
+	if rv.Kind() != reflect.Slice {
+		return errors.New("map tag requires slice, got " + rv.Kind().String())
+	}
+	rt := rv.Type().Elem()
+	ki, vi, err := mapEntryFields(rt)
+	if err != nil {
+		return err
+	}
+	keyTag, err := newFieldTag(rt, rt.Field(ki).Tag.Get(lcsTagName))
+	if err != nil {
+		return err
+	}
+	valueTag, err := newFieldTag(rt, rt.Field(vi).Tag.Get(lcsTagName))
+	if err != nil {
+		return err
+	}
+	return e.encodeSorted(rv.Len(), false,
+		func(sub *Encoder, i int) error {
+			err := sub.encode(rv.Index(i).Field(ki), nil, keyTag)
+			return withIndex(withPath(err, rt.Field(ki).Name), i)
+		},
+		func(sub *Encoder, i int) error {
+			err := sub.encode(rv.Index(i).Field(vi), nil, valueTag)
+			return withIndex(withPath(err, rt.Field(vi).Name), i)
+		})
+}
+
+// encodeSorted encodes a sequence of n items, sorted by the encoded bytes of their keys.
+// Items are encoded into an arena by encodeKey and encodeValue (nil for sets), with the
+// same settings as e. Duplicated keys are removed if dedupe is true, or rejected otherwise.
+func (e *Encoder) encodeSorted(n int, dedupe bool,
+	encodeKey, encodeValue func(sub *Encoder, i int) error) (err error) {
+	if e.sub == nil {
+		e.subBuf = new(bytes.Buffer)
+		e.sub = &Encoder{w: e.subBuf, opts: e.opts, enums: e.enums}
+	}
+	sub, buf := e.sub, e.subBuf
+	buf.Reset()
+
+	type span struct{ start, keyEnd, end int }
+	spans := make([]span, n)
+	for i := range spans {
+		spans[i].start = buf.Len()
+		if err = encodeKey(sub, i); err != nil {
+			return
+		}
+		spans[i].keyEnd = buf.Len()
+		if encodeValue != nil {
+			if err = encodeValue(sub, i); err != nil {
+				return
+			}
+		}
+		spans[i].end = buf.Len()
+	}
+
+	data := buf.Bytes()
+	key := func(s span) []byte { return data[s.start:s.keyEnd] }
+	sort.Slice(spans, func(i, j int) bool {
+		return bytes.Compare(key(spans[i]), key(spans[j])) < 0
+	})
+	uniq := spans[:0]
+	for _, s := range spans {
+		if len(uniq) > 0 && bytes.Equal(key(s), key(uniq[len(uniq)-1])) {
+			if dedupe {
+				continue
+			}
+			return errors.New("duplicated map key")
+		}
+		uniq = append(uniq, s)
+	}
+
+	if _, err = writeVarUint(e.w, uint64(len(uniq))); err != nil {
+		return
+	}
+	for _, s := range uniq {
+		if _, err = e.w.Write(data[s.start:s.end]); err != nil {
+			return
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) getEnumVariants(rt reflect.Type) map[string]map[reflect.Type]EnumKeyType {
+	vv, ok := reflect.Zero(rt).Interface().(EnumTypeUser)
+	if !ok {
+		vv, ok = reflect.Zero(reflect.PtrTo(rt)).Interface().(EnumTypeUser)
+		if !ok {
+			return nil
+		}
+	}
+	r := make(map[string]map[reflect.Type]EnumKeyType)
+	evs := vv.EnumTypes()
+	for _, ev := range evs {
+		evt := reflect.TypeOf(ev.Template)
+		if r[ev.Name] == nil {
+			r[ev.Name] = make(map[reflect.Type]EnumKeyType)
+		}
+		r[ev.Name][evt] = ev.Value
+	}
+	return r
+}
+
+// Compare returns an integer comparing the LCS encodings of a and b, which is the canonical
+// order of keys in maps and elements in sets. The result is 0 if a==b, -1 if a < b, and +1
+// if a > b.
+func Compare(a, b interface{}) (int, error) {
+	ab, err := Marshal(a)
+	if err != nil {
+		return 0, err
+	}
+	bb, err := Marshal(b)
+	if err != nil {
+		return 0, err
+	}
+	return bytes.Compare(ab, bb), nil
+}
+
+func Marshal(v interface{}) ([]byte, error) {
+	return MarshalWithOptions(v, EncoderOptions{})
+}
+
+// MarshalWithOptions returns the LCS encoding of v, with the given options.
+func MarshalWithOptions(v interface{}, opts EncoderOptions) ([]byte, error) {
+	var b bytes.Buffer
+	e := NewEncoderWithOptions(&b, opts)
+	if err := e.Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -1,12 +1,17 @@
 package lcs
 
 import (
+	"errors"
+	"fmt"
 	"reflect"
 )
 
 var regEnumTypeToIdx map[reflect.Type]map[reflect.Type]EnumKeyType
 var regEnumIdxToType map[reflect.Type][]reflect.Type
 
+// regVariantEnums indexes the enum types of each variant type, for checkBareVariant.
+var regVariantEnums map[reflect.Type]map[reflect.Type]bool
+
 // RegisterEnum register an enum type with its available variants. If the enum type
 // was registered, it will be overwriten.
 //
@@ -26,6 +31,12 @@ func RegisterEnum(enumTypePtr interface{}, types ...interface{}) (err error) {
 	if regEnumIdxToType == nil {
 		regEnumIdxToType = make(map[reflect.Type][]reflect.Type)
 	}
+	if regVariantEnums == nil {
+		regVariantEnums = make(map[reflect.Type]map[reflect.Type]bool)
+	}
+	for _, t := range regEnumIdxToType[rEnumType] {
+		delete(regVariantEnums[t], rEnumType)
+	}
 	regEnumIdxToType[rEnumType] = make([]reflect.Type, 0, len(types))
 	regEnumTypeToIdx[rEnumType] = make(map[reflect.Type]uint64)
 	for i, t := range types {
@@ -35,6 +46,10 @@ func RegisterEnum(enumTypePtr interface{}, types ...interface{}) (err error) {
 		}
 		regEnumIdxToType[rEnumType] = append(regEnumIdxToType[rEnumType], rType)
 		regEnumTypeToIdx[rEnumType][rType] = EnumKeyType(i)
+		if regVariantEnums[rType] == nil {
+			regVariantEnums[rType] = make(map[reflect.Type]bool)
+		}
+		regVariantEnums[rType][rEnumType] = true
 	}
 	// log.Printf("registered: %v", rEnumType.String())
 	return
@@ -61,3 +76,144 @@ func enumGetIdxByType(enumType, vType reflect.Type) (EnumKeyType, bool) {
 	idx, ok := m[vType]
 	return idx, ok
 }
+
+var regCEnumSize map[reflect.Type]EnumKeyType
+
+// RegisterCEnum registers a named integer type as a C-style enum, i.e. a Rust enum whose
+// variants carry no data. Such values are encoded as a ULEB128 discriminant, and only
+// values in the range [0, count) are valid.
+//
+// This function panics on errors. The returned error is always nil.
+func RegisterCEnum(enumTypePtr interface{}, count EnumKeyType) (err error) {
+	rEnumType := reflect.TypeOf(enumTypePtr)
+	if rEnumType == nil || rEnumType.Kind() != reflect.Ptr {
+		panic("enumType should be a pointer to an integer type")
+	}
+	rEnumType = rEnumType.Elem()
+	if !isIntegerKind(rEnumType.Kind()) {
+		panic("enumType should be a pointer to an integer type")
+	}
+	if count == 0 {
+		panic("C-style enum " + rEnumType.String() + " should have at least one variant")
+	}
+	if isSignedKind(rEnumType.Kind()) {
+		if count-1 > uint64(1<<63-1) || reflect.Zero(rEnumType).OverflowInt(int64(count-1)) {
+			panic("C-style enum " + rEnumType.String() + " cannot hold all variants")
+		}
+	} else if reflect.Zero(rEnumType).OverflowUint(count - 1) {
+		panic("C-style enum " + rEnumType.String() + " cannot hold all variants")
+	}
+	if regCEnumSize == nil {
+		regCEnumSize = make(map[reflect.Type]EnumKeyType)
+	}
+	regCEnumSize[rEnumType] = count
+	return
+}
+
+func cEnumGetSize(t reflect.Type) (EnumKeyType, bool) {
+	count, ok := regCEnumSize[t]
+	return count, ok
+}
+
+func isIntegerKind(k reflect.Kind) bool {
+	return isSignedKind(k) || isUnsignedKind(k)
+}
+
+func isSignedKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isUnsignedKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// MarshalEnum encodes v as a value of the registered enum type, including its discriminant.
+// enumTypePtr is the nil pointer to the enum interface type, as used in RegisterEnum.
+//
+// Use MarshalEnum instead of Marshal when the enum value is held in a variable of the enum
+// interface type: Marshal(e) only sees the concrete variant and cannot encode the discriminant.
+func MarshalEnum(enumTypePtr interface{}, v interface{}) ([]byte, error) {
+	rEnumType, err := registeredEnumType(enumTypePtr)
+	if err != nil {
+		return nil, err
+	}
+	rv := reflect.New(rEnumType)
+	vv := reflect.ValueOf(v)
+	if !vv.IsValid() {
+		return nil, errors.New("non-optional enum value is nil")
+	}
+	if !vv.Type().Implements(rEnumType) {
+		return nil, errors.New(vv.Type().String() + " does not implement " + rEnumType.String())
+	}
+	rv.Elem().Set(vv)
+	return Marshal(rv.Interface())
+}
+
+// UnmarshalEnum decodes data as a value of the registered enum type, and returns the variant.
+// enumTypePtr is the nil pointer to the enum interface type, as used in RegisterEnum.
+func UnmarshalEnum(data []byte, enumTypePtr interface{}) (interface{}, error) {
+	rEnumType, err := registeredEnumType(enumTypePtr)
+	if err != nil {
+		return nil, err
+	}
+	rv := reflect.New(rEnumType)
+	if err = Unmarshal(data, rv.Interface()); err != nil {
+		return nil, err
+	}
+	return rv.Elem().Interface(), nil
+}
+
+func registeredEnumType(enumTypePtr interface{}) (reflect.Type, error) {
+	rEnumType := reflect.TypeOf(enumTypePtr)
+	if rEnumType == nil || rEnumType.Kind() != reflect.Ptr || rEnumType.Elem().Kind() != reflect.Interface {
+		return nil, errors.New("enumType should be a pointer to a nil interface")
+	}
+	rEnumType = rEnumType.Elem()
+	if _, ok := regEnumIdxToType[rEnumType]; !ok {
+		return nil, errors.New("enum " + rEnumType.String() + " is not registered")
+	}
+	return rEnumType, nil
+}
+
+// checkBareVariant returns an error if t is a variant of exactly one registered enum type.
+// Encoding such a value directly loses the enum discriminant, which is almost always caused
+// by passing an enum interface value instead of a pointer to it. A variant is encoded alone
+// in the form it is not registered in, i.e. by value for pointer variants, and by pointer for
+// other variants.
+//
+// Predeclared and unnamed types (uint64, [32]byte, etc.) are often shared by many enums and
+// plain values, so only defined types and pointers to them are checked.
+func checkBareVariant(t reflect.Type) error {
+	if t == nil {
+		return nil
+	}
+	named := t
+	if named.Kind() == reflect.Ptr {
+		named = named.Elem()
+	}
+	if named.PkgPath() == "" {
+		return nil
+	}
+	enums := regVariantEnums[t]
+	if len(enums) != 1 {
+		return nil
+	}
+	var enumType reflect.Type
+	for enumType = range enums {
+		break
+	}
+	alone := "&v"
+	if t.Kind() == reflect.Ptr {
+		alone = "*v"
+	}
+	return fmt.Errorf("%s is a variant of enum %s, use MarshalEnum((*%s)(nil), v) or pass a pointer to the enum value to encode its discriminant, or pass %s to encode the variant alone",
+		t, enumType, enumType, alone)
+}
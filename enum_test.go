@@ -1,6 +1,7 @@
 package lcs
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -74,3 +75,113 @@ func TestRegisterWrongVariantShouldPanic(t *testing.T) {
 		RegisterEnum((*Enum1)(nil), uint32(0))
 	})
 }
+
+type CEnum1 uint8
+
+func TestCEnum(t *testing.T) {
+	RegisterCEnum((*CEnum1)(nil), 3)
+	type Wrapper struct {
+		Status CEnum1
+		Data   uint16
+	}
+	runTest(t, []*testCase{
+		{
+			v:    CEnum1(2),
+			b:    hexMustDecode("02"),
+			name: "c enum",
+		},
+		{
+			v:    Wrapper{Status: 1, Data: 5},
+			b:    hexMustDecode("01 0500"),
+			name: "c enum in struct",
+		},
+		{
+			v:            CEnum1(3),
+			b:            hexMustDecode("03"),
+			errMarshal:   errors.New("enum lcs.CEnum1 value 3 out of range [0, 3)"),
+			errUnmarshal: errors.New("enum lcs.CEnum1 discriminant 3 out of range [0, 3)"),
+			name:         "c enum out of range",
+		},
+	})
+}
+
+func TestRegisterCEnumShouldPanic(t *testing.T) {
+	assert.Panics(t, func() {
+		RegisterCEnum(CEnum1(0), 3)
+	})
+	assert.Panics(t, func() {
+		RegisterCEnum((*Enum1Opt0)(nil), 3)
+	})
+	assert.Panics(t, func() {
+		RegisterCEnum((*CEnum1)(nil), 0)
+	})
+	assert.Panics(t, func() {
+		RegisterCEnum((*CEnum1)(nil), 257)
+	})
+}
+
+func TestMarshalEnum(t *testing.T) {
+	RegisterEnum((*Enum1)(nil),
+		(*Enum1Opt0)(nil),
+		Enum1Opt1(false),
+		Enum1Opt2(nil),
+		Enum1Opt3(nil),
+	)
+	e := Enum1(Enum1Opt1(true))
+
+	b, err := MarshalEnum((*Enum1)(nil), e)
+	assert.NoError(t, err)
+	assert.Equal(t, hexMustDecode("01 01"), b)
+
+	v, err := UnmarshalEnum(b, (*Enum1)(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, e, v)
+
+	_, err = MarshalEnum((*Enum1)(nil), uint32(1))
+	assert.EqualError(t, err, "uint32 does not implement lcs.Enum1")
+
+	_, err = MarshalEnum((*isOption)(nil), Option1{})
+	assert.EqualError(t, err, "enum lcs.isOption is not registered")
+
+	_, err = Marshal(e)
+	assert.EqualError(t, err, "lcs.Enum1Opt1 is a variant of enum lcs.Enum1, use MarshalEnum((*lcs.Enum1)(nil), v) or pass a pointer to the enum value to encode its discriminant, or pass &v to encode the variant alone")
+
+	_, err = Marshal(Enum1(&Enum1Opt0{3}))
+	assert.EqualError(t, err, "*lcs.Enum1Opt0 is a variant of enum lcs.Enum1, use MarshalEnum((*lcs.Enum1)(nil), v) or pass a pointer to the enum value to encode its discriminant, or pass *v to encode the variant alone")
+
+	// the forms which are not registered encode the variant alone
+	opt1 := Enum1Opt1(true)
+	b, err = Marshal(&opt1)
+	assert.NoError(t, err)
+	assert.Equal(t, hexMustDecode("01"), b)
+	b, err = Marshal(Enum1Opt0{3})
+	assert.NoError(t, err)
+	assert.Equal(t, hexMustDecode("03000000"), b)
+
+	// a re-registered enum drops its old variants
+	RegisterEnum((*Enum1)(nil), (*Enum1Opt0)(nil))
+	_, err = Marshal(Enum1Opt1(true))
+	assert.NoError(t, err)
+	RegisterEnum((*Enum1)(nil),
+		(*Enum1Opt0)(nil),
+		Enum1Opt1(false),
+		Enum1Opt2(nil),
+		Enum1Opt3(nil),
+	)
+}
+
+func TestEnumInMap(t *testing.T) {
+	RegisterEnum((*Enum1)(nil),
+		(*Enum1Opt0)(nil),
+		Enum1Opt1(false),
+		Enum1Opt2(nil),
+		Enum1Opt3(nil),
+	)
+	runTest(t, []*testCase{
+		{
+			v:    map[uint8]Enum1{1: Enum1Opt1(true)},
+			b:    hexMustDecode("01 01 01 01"),
+			name: "enum as map value",
+		},
+	})
+}
@@ -0,0 +1,161 @@
+package lcs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// errStopWalk stops a walk once the visited span is found.
+var errStopWalk = errors.New("stop walk")
+
+// findPath walks data of type typ until the value at path, and returns its span.
+func findPath(data []byte, typ reflect.Type, path string, opts DecoderOptions) (*walkSpan, error) {
+	var found, part *walkSpan
+	var w *walker
+	w = newWalker(data, opts, false, func(s *walkSpan) error {
+		if found != nil {
+			return errStopWalk
+		}
+		switch {
+		case s.label != "":
+			part = s
+		case s.path == path:
+			found = s
+		case s.leaf && strings.HasPrefix(path, s.path+"["):
+			// the elements of a leaf start after its presence byte and length
+			start := s.start
+			if part != nil && part.path == s.path && part.end > start {
+				start = part.end
+			}
+			found = w.elemSpan(s, start, path[len(s.path):])
+		}
+		if found != nil {
+			return errStopWalk
+		}
+		return nil
+	})
+	err := w.walk(typ, "", nil, nil, 0)
+	if found != nil {
+		return found, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("path %q not found", path)
+}
+
+// elemSpan returns the span of the element at index, such as "[1]", of s, a leaf whose
+// elements start at offset start. It returns nil if s is not a slice or array of bulk
+// elements, which are decoded as a whole, or if it has no such element.
+func (w *walker) elemSpan(s *walkSpan, start int, index string) *walkSpan {
+	t := s.typ
+	if t.Kind() != reflect.Slice && t.Kind() != reflect.Array || w.hasCodec(t) ||
+		!isBulkElem(t.Elem(), s.decl.tag.scope("elem", false), w.d.opts.Registry) {
+		return nil
+	}
+	if len(index) < 3 || index[len(index)-1] != ']' {
+		return nil
+	}
+	i, err := strconv.Atoi(index[1 : len(index)-1])
+	if err != nil || strconv.Itoa(i) != index[1:len(index)-1] || i < 0 {
+		return nil
+	}
+	size := int(t.Elem().Size())
+	if start+(i+1)*size > s.end {
+		return nil
+	}
+	start += i * size
+	return &walkSpan{
+		path:  s.path + index,
+		typ:   t.Elem(),
+		start: start,
+		end:   start + size,
+		depth: s.depth + 1,
+		leaf:  true,
+		decl:  &walkDecl{typ: t.Elem()},
+	}
+}
+
+// Extract decodes the value at path in data, an encoded value of type typ. See
+// ExtractWithOptions.
+func Extract(data []byte, typ reflect.Type, path string) (interface{}, error) {
+	return ExtractWithOptions(data, typ, path, DecoderOptions{})
+}
+
+// ExtractWithOptions decodes the value at path in data, an encoded value of type typ, with
+// the given options. The values before it are walked by their encoding instead of being
+// decoded into Go values, though map keys and values of fixed size are still decoded, and
+// the values after it are not read at all.
+//
+// Paths have the same syntax as in Annotate, e.g. `Resources["Balance"].Coin.Value`, where
+// map keys are quoted strings, integers, booleans, or their encoded bytes in hex.
+//
+// The returned value has the type of the field at path. Enum values have their variant type.
+func ExtractWithOptions(data []byte, typ reflect.Type, path string, opts DecoderOptions) (interface{}, error) {
+	s, err := findPath(data, typ, path, opts)
+	if err != nil {
+		return nil, err
+	}
+	v := reflect.New(s.decl.typ).Elem()
+	d := NewDecoderFromBytes(data[s.start:s.end], opts)
+	if err = d.decode(v, s.decl.enumVariants, s.decl.tag); err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+// Patch returns a copy of data, an encoded value of type typ, with the value at path replaced
+// by newValue. See PatchWithOptions.
+func Patch(data []byte, typ reflect.Type, path string, newValue interface{}) ([]byte, error) {
+	return PatchWithOptions(data, typ, path, newValue, DecoderOptions{})
+}
+
+// PatchWithOptions returns a copy of data, an encoded value of type typ, with the value at
+// path replaced by newValue, with the registry in opts. Only the bytes of the value are
+// replaced, so the lengths of the values around it stay correct.
+//
+// newValue should be assignable to the type of the field at path. The patched data is
+// verified to decode, e.g. a patched set element should keep the set in canonical order.
+func PatchWithOptions(data []byte, typ reflect.Type, path string, newValue interface{}, opts DecoderOptions) ([]byte, error) {
+	s, err := findPath(data, typ, path, opts)
+	if err != nil {
+		return nil, err
+	}
+	v := reflect.New(s.decl.typ).Elem()
+	if newValue != nil {
+		nv := reflect.ValueOf(newValue)
+		if !nv.Type().AssignableTo(v.Type()) {
+			return nil, fmt.Errorf("cannot patch %s of type %s with %s", path, v.Type(), nv.Type())
+		}
+		v.Set(nv)
+	}
+	var enumVariants map[reflect.Type]EnumKeyType
+	if s.decl.enumVariants != nil {
+		enumVariants = make(map[reflect.Type]EnumKeyType, len(s.decl.enumVariants))
+		for k, t := range s.decl.enumVariants {
+			enumVariants[t] = k
+		}
+	}
+	var buf bytes.Buffer
+	e := NewEncoderWithOptions(&buf, EncoderOptions{Registry: opts.Registry})
+	if err = e.encode(v, enumVariants, s.decl.tag); err != nil {
+		return nil, err
+	}
+	if err = e.flush(); err != nil {
+		return nil, err
+	}
+
+	patched := make([]byte, 0, len(data)-(s.end-s.start)+buf.Len())
+	patched = append(patched, data[:s.start]...)
+	patched = append(patched, buf.Bytes()...)
+	patched = append(patched, data[s.end:]...)
+	w := newWalker(patched, opts, false, nil)
+	if err = w.walk(typ, "", nil, nil, 0); err != nil {
+		return nil, fmt.Errorf("patched data: %v", err)
+	}
+	return patched, nil
+}
@@ -0,0 +1,132 @@
+package lcs
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// Validator is implemented by structs which validate themselves after being decoded, e.g.
+// an amount should be positive. ValidateLCS is called by the Decoder once all fields of the
+// struct are decoded, including the structs inside it, which are validated first.
+type Validator interface {
+	ValidateLCS() error
+}
+
+// BeforeEncoder is implemented by structs which validate or prepare themselves before being
+// encoded. BeforeEncodeLCS is called by the Encoder before the fields of the struct are
+// encoded. If the struct is not addressable, e.g. it is passed to Marshal by value, the
+// method is called on a copy, which is then encoded.
+//
+// Unlike a custom codec, the hooks do not change how the struct is encoded.
+type BeforeEncoder interface {
+	BeforeEncodeLCS() error
+}
+
+// HookError is an error returned by ValidateLCS or BeforeEncodeLCS.
+type HookError struct {
+	// Path is the path of the struct, in the syntax of Extract, which is empty for the root
+	// value.
+	Path string
+	Err  error
+}
+
+func (e *HookError) Error() string {
+	if e.Path == "" {
+		return e.Err.Error()
+	}
+	return e.Path + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error returned by the hook.
+func (e *HookError) Unwrap() error { return e.Err }
+
+var (
+	validatorType     = reflect.TypeOf((*Validator)(nil)).Elem()
+	beforeEncoderType = reflect.TypeOf((*BeforeEncoder)(nil)).Elem()
+)
+
+// structHooks tells which hooks are implemented by a struct type or its pointer type.
+type structHooks struct {
+	validate, beforeEncode bool
+}
+
+// structHooksCache caches the hooks of struct types: map[reflect.Type]structHooks.
+var structHooksCache sync.Map
+
+func hooksOf(rt reflect.Type) structHooks {
+	if h, ok := structHooksCache.Load(rt); ok {
+		return h.(structHooks)
+	}
+	pt := reflect.PtrTo(rt)
+	h := structHooks{
+		validate:     pt.Implements(validatorType),
+		beforeEncode: pt.Implements(beforeEncoderType),
+	}
+	structHooksCache.Store(rt, h)
+	return h
+}
+
+// validate calls ValidateLCS of rv, an addressable struct, if it is implemented.
+func validate(rv reflect.Value) error {
+	if !hooksOf(rv.Type()).validate {
+		return nil
+	}
+	if err := rv.Addr().Interface().(Validator).ValidateLCS(); err != nil {
+		return &HookError{Err: err}
+	}
+	return nil
+}
+
+// beforeEncode calls BeforeEncodeLCS of rv, a struct, if it is implemented, and returns the
+// value to encode, which is an addressable copy if rv is not addressable.
+func beforeEncode(rv reflect.Value) (reflect.Value, error) {
+	if !hooksOf(rv.Type()).beforeEncode {
+		return rv, nil
+	}
+	if !rv.CanAddr() {
+		c := reflect.New(rv.Type()).Elem()
+		c.Set(rv)
+		rv = c
+	}
+	if err := rv.Addr().Interface().(BeforeEncoder).BeforeEncodeLCS(); err != nil {
+		return rv, &HookError{Err: err}
+	}
+	return rv, nil
+}
+
+// withPath prepends elem, a field name or an index such as "[1]", to the path of err if it
+// is a HookError.
+func withPath(err error, elem string) error {
+	he, ok := err.(*HookError)
+	if !ok {
+		return err
+	}
+	if he.Path == "" || he.Path[0] == '[' {
+		he.Path = elem + he.Path
+	} else {
+		he.Path = elem + "." + he.Path
+	}
+	return err
+}
+
+func withIndex(err error, i int) error {
+	if _, ok := err.(*HookError); !ok {
+		return err
+	}
+	return withPath(err, "["+strconv.Itoa(i)+"]")
+}
+
+// withKey prepends the map key k to the path of err if it is a HookError.
+func withKey(err error, k reflect.Value, tag *fieldTag, r *Registry) error {
+	if _, ok := err.(*HookError); !ok {
+		return err
+	}
+	var buf bytes.Buffer
+	e := NewEncoderWithOptions(&buf, EncoderOptions{Registry: r})
+	if e.encode(k, nil, tag) != nil || e.flush() != nil {
+		buf.Reset()
+	}
+	return withPath(err, "["+formatKey(k, buf.Bytes())+"]")
+}
@@ -0,0 +1,86 @@
+package lcstypes
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/the729/lcs"
+)
+
+// AddressLength is the length of account addresses in bytes, which is 16 for Libra and 32
+// for earlier generations of the chain. Set it during initialization.
+var AddressLength = 16
+
+// AccountAddress is an account address. It is encoded as AddressLength bytes, without length.
+type AccountAddress []byte
+
+// ParseAccountAddress parses an address in hex, with an optional 0x prefix. With the prefix,
+// leading zeros can be omitted, e.g. "0x1".
+func ParseAccountAddress(s string) (AccountAddress, error) {
+	h := s
+	if strings.HasPrefix(h, "0x") {
+		h = h[2:]
+		if len(h) < 2*AddressLength {
+			h = strings.Repeat("0", 2*AddressLength-len(h)) + h
+		}
+	}
+	b, err := decodeHex(s, h, AddressLength, "address")
+	if err != nil {
+		return nil, err
+	}
+	return AccountAddress(b), nil
+}
+
+// Validate returns an error if the address does not have AddressLength bytes.
+func (a AccountAddress) Validate() error {
+	if len(a) != AddressLength {
+		return fmt.Errorf("address should have %d bytes, got %d", AddressLength, len(a))
+	}
+	return nil
+}
+
+// String returns the address in hex.
+func (a AccountAddress) String() string {
+	return hex.EncodeToString(a)
+}
+
+// MarshalText encodes the address in hex, which is also used by encoding/json.
+func (a AccountAddress) MarshalText() ([]byte, error) {
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText decodes the address in the format of ParseAccountAddress.
+func (a *AccountAddress) UnmarshalText(text []byte) error {
+	addr, err := ParseAccountAddress(string(text))
+	if err != nil {
+		return err
+	}
+	*a = addr
+	return nil
+}
+
+func encodeAccountAddress(e *lcs.Encoder, v reflect.Value) error {
+	a := v.Interface().(AccountAddress)
+	if err := a.Validate(); err != nil {
+		return err
+	}
+	arr := reflect.New(reflect.ArrayOf(AddressLength, reflect.TypeOf(byte(0)))).Elem()
+	reflect.Copy(arr, reflect.ValueOf([]byte(a)))
+	return e.Encode(arr.Interface())
+}
+
+func decodeAccountAddress(d *lcs.Decoder, v reflect.Value) error {
+	arr := reflect.New(reflect.ArrayOf(AddressLength, reflect.TypeOf(byte(0))))
+	if err := d.Decode(arr.Interface()); err != nil {
+		return err
+	}
+	a := make(AccountAddress, AddressLength)
+	reflect.Copy(reflect.ValueOf([]byte(a)), arr.Elem())
+	v.Set(reflect.ValueOf(a))
+	return nil
+}
@@ -0,0 +1,115 @@
+package lcstypes
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"reflect"
+	"strings"
+
+	"github.com/the729/lcs"
+)
+
+// MaxBitVecBytes is the maximum number of bytes of a BitVec, which holds bits 0 to 255.
+const MaxBitVecBytes = 32
+
+// BitVec is a set of bits, such as the signers of a multi-signature. Bit i is the bit
+// 0x80>>(i%8) of byte i/8. It is encoded as bytes with length.
+//
+// A valid BitVec has at most MaxBitVecBytes bytes, and no trailing zero bytes, so that each
+// set of bits has one encoding.
+type BitVec []byte
+
+// Set sets bit i.
+func (b *BitVec) Set(i uint8) {
+	for len(*b) <= int(i/8) {
+		*b = append(*b, 0)
+	}
+	(*b)[i/8] |= 0x80 >> (i % 8)
+}
+
+// Unset clears bit i, and removes the trailing zero bytes.
+func (b *BitVec) Unset(i uint8) {
+	if int(i/8) >= len(*b) {
+		return
+	}
+	(*b)[i/8] &^= 0x80 >> (i % 8)
+	n := len(*b)
+	for n > 0 && (*b)[n-1] == 0 {
+		n--
+	}
+	*b = (*b)[:n]
+}
+
+// IsSet returns whether bit i is set.
+func (b BitVec) IsSet(i uint8) bool {
+	return int(i/8) < len(b) && b[i/8]&(0x80>>(i%8)) != 0
+}
+
+// CountOnes returns the number of set bits.
+func (b BitVec) CountOnes() int {
+	n := 0
+	for _, c := range b {
+		n += bits.OnesCount8(c)
+	}
+	return n
+}
+
+// Validate returns an error if the BitVec has more than MaxBitVecBytes bytes, or trailing
+// zero bytes.
+func (b BitVec) Validate() error {
+	if len(b) > MaxBitVecBytes {
+		return fmt.Errorf("bit vector should have at most %d bytes, got %d", MaxBitVecBytes, len(b))
+	}
+	if len(b) > 0 && b[len(b)-1] == 0 {
+		return errors.New("bit vector has trailing zero bytes")
+	}
+	return nil
+}
+
+// String returns the bytes in hex.
+func (b BitVec) String() string {
+	return hex.EncodeToString(b)
+}
+
+// MarshalText encodes the bytes in hex, which is also used by encoding/json.
+func (b BitVec) MarshalText() ([]byte, error) {
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	return []byte(b.String()), nil
+}
+
+// UnmarshalText decodes the bytes in hex, with an optional 0x prefix.
+func (b *BitVec) UnmarshalText(text []byte) error {
+	v, err := hex.DecodeString(strings.TrimPrefix(string(text), "0x"))
+	if err != nil {
+		return fmt.Errorf("invalid bit vector %q: %v", text, err)
+	}
+	if err = BitVec(v).Validate(); err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
+
+func encodeBitVec(e *lcs.Encoder, v reflect.Value) error {
+	b := v.Interface().(BitVec)
+	if err := b.Validate(); err != nil {
+		return err
+	}
+	return e.Encode([]byte(b))
+}
+
+func decodeBitVec(d *lcs.Decoder, v reflect.Value) error {
+	var b []byte
+	if err := d.Decode(&b); err != nil {
+		return err
+	}
+	if err := BitVec(b).Validate(); err != nil {
+		return err
+	}
+	v.Set(reflect.ValueOf(BitVec(b)))
+	return nil
+}
@@ -0,0 +1,65 @@
+package lcstypes
+
+import (
+	"encoding/hex"
+)
+
+// Ed25519PublicKey is an Ed25519 public key. It is encoded as bytes with length, like
+// serde_bytes.
+type Ed25519PublicKey [32]byte
+
+// Ed25519Signature is an Ed25519 signature. It is encoded as bytes with length, like
+// serde_bytes.
+type Ed25519Signature [64]byte
+
+// ParseEd25519PublicKey parses a public key in hex, with an optional 0x prefix.
+func ParseEd25519PublicKey(s string) (k Ed25519PublicKey, err error) {
+	b, err := parseHex(s, len(k), "public key")
+	if err != nil {
+		return k, err
+	}
+	copy(k[:], b)
+	return k, nil
+}
+
+// String returns the public key in hex.
+func (k Ed25519PublicKey) String() string {
+	return hex.EncodeToString(k[:])
+}
+
+// MarshalText encodes the public key in hex, which is also used by encoding/json.
+func (k Ed25519PublicKey) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText decodes the public key in hex, with an optional 0x prefix.
+func (k *Ed25519PublicKey) UnmarshalText(text []byte) (err error) {
+	*k, err = ParseEd25519PublicKey(string(text))
+	return err
+}
+
+// ParseEd25519Signature parses a signature in hex, with an optional 0x prefix.
+func ParseEd25519Signature(s string) (sig Ed25519Signature, err error) {
+	b, err := parseHex(s, len(sig), "signature")
+	if err != nil {
+		return sig, err
+	}
+	copy(sig[:], b)
+	return sig, nil
+}
+
+// String returns the signature in hex.
+func (sig Ed25519Signature) String() string {
+	return hex.EncodeToString(sig[:])
+}
+
+// MarshalText encodes the signature in hex, which is also used by encoding/json.
+func (sig Ed25519Signature) MarshalText() ([]byte, error) {
+	return []byte(sig.String()), nil
+}
+
+// UnmarshalText decodes the signature in hex, with an optional 0x prefix.
+func (sig *Ed25519Signature) UnmarshalText(text []byte) (err error) {
+	*sig, err = ParseEd25519Signature(string(text))
+	return err
+}
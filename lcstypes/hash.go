@@ -0,0 +1,34 @@
+package lcstypes
+
+import (
+	"encoding/hex"
+)
+
+// HashValue is a SHA3-256 hash. It is encoded as bytes with length, like serde_bytes.
+type HashValue [32]byte
+
+// ParseHashValue parses a hash in hex, with an optional 0x prefix.
+func ParseHashValue(s string) (h HashValue, err error) {
+	b, err := parseHex(s, len(h), "hash")
+	if err != nil {
+		return h, err
+	}
+	copy(h[:], b)
+	return h, nil
+}
+
+// String returns the hash in hex.
+func (h HashValue) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// MarshalText encodes the hash in hex, which is also used by encoding/json.
+func (h HashValue) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText decodes the hash in hex, with an optional 0x prefix.
+func (h *HashValue) UnmarshalText(text []byte) (err error) {
+	*h, err = ParseHashValue(string(text))
+	return err
+}
@@ -0,0 +1,66 @@
+package lcstypes
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/the729/lcs"
+)
+
+// Identifier is the name of a Move module, struct or function. It is encoded as a string.
+type Identifier string
+
+// Validate returns an error if the identifier is not valid. A valid identifier starts with a
+// letter, or an underscore followed by at least one more character, and has only letters,
+// digits and underscores.
+func (id Identifier) Validate() error {
+	if id == "" || id == "_" {
+		return fmt.Errorf("invalid identifier %q", string(id))
+	}
+	for i, c := range id {
+		switch {
+		case c == '_', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9' && i > 0:
+		default:
+			return fmt.Errorf("invalid identifier %q", string(id))
+		}
+	}
+	return nil
+}
+
+// MarshalText returns the identifier, which is also used by encoding/json.
+func (id Identifier) MarshalText() ([]byte, error) {
+	if err := id.Validate(); err != nil {
+		return nil, err
+	}
+	return []byte(id), nil
+}
+
+// UnmarshalText sets the identifier to text, which should be valid.
+func (id *Identifier) UnmarshalText(text []byte) error {
+	if err := Identifier(text).Validate(); err != nil {
+		return err
+	}
+	*id = Identifier(text)
+	return nil
+}
+
+func encodeIdentifier(e *lcs.Encoder, v reflect.Value) error {
+	id := Identifier(v.String())
+	if err := id.Validate(); err != nil {
+		return err
+	}
+	return e.Encode(string(id))
+}
+
+func decodeIdentifier(d *lcs.Decoder, v reflect.Value) error {
+	var s string
+	if err := d.Decode(&s); err != nil {
+		return err
+	}
+	if err := Identifier(s).Validate(); err != nil {
+		return err
+	}
+	v.SetString(s)
+	return nil
+}
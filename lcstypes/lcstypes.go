@@ -0,0 +1,68 @@
+// Package lcstypes has the primitive types shared by Libra and Diem data structures, with
+// their LCS encoding, validation, and hex text and JSON marshaling.
+//
+// The codecs of the types are registered in lcs.DefaultRegistry. Call RegisterCodecs to use
+// them with another registry.
+package lcstypes
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/the729/lcs"
+)
+
+func init() {
+	RegisterCodecs(lcs.DefaultRegistry)
+}
+
+// RegisterCodecs registers the codecs of AccountAddress, HashValue, Identifier, BitVec,
+// Ed25519PublicKey and Ed25519Signature in r. They validate values when encoding and
+// decoding.
+func RegisterCodecs(r *lcs.Registry) {
+	r.RegisterCodec(reflect.TypeOf(AccountAddress(nil)), encodeAccountAddress, decodeAccountAddress)
+	r.RegisterCodec(reflect.TypeOf(HashValue{}), encodeFixedBytes, decodeFixedBytes)
+	r.RegisterCodec(reflect.TypeOf(Ed25519PublicKey{}), encodeFixedBytes, decodeFixedBytes)
+	r.RegisterCodec(reflect.TypeOf(Ed25519Signature{}), encodeFixedBytes, decodeFixedBytes)
+	r.RegisterCodec(reflect.TypeOf(Identifier("")), encodeIdentifier, decodeIdentifier)
+	r.RegisterCodec(reflect.TypeOf(BitVec(nil)), encodeBitVec, decodeBitVec)
+}
+
+// encodeFixedBytes encodes a byte array as a byte slice with its length, as serde_bytes does.
+func encodeFixedBytes(e *lcs.Encoder, v reflect.Value) error {
+	b := make([]byte, v.Len())
+	reflect.Copy(reflect.ValueOf(b), v)
+	return e.Encode(b)
+}
+
+// decodeFixedBytes decodes a byte slice into a byte array, whose length should match.
+func decodeFixedBytes(d *lcs.Decoder, v reflect.Value) error {
+	var b []byte
+	if err := d.Decode(&b); err != nil {
+		return err
+	}
+	if len(b) != v.Len() {
+		return fmt.Errorf("%s should have %d bytes, got %d", v.Type(), v.Len(), len(b))
+	}
+	reflect.Copy(v, reflect.ValueOf(b))
+	return nil
+}
+
+// parseHex decodes s, hex with an optional 0x prefix, which should have n bytes.
+func parseHex(s string, n int, name string) ([]byte, error) {
+	return decodeHex(s, strings.TrimPrefix(s, "0x"), n, name)
+}
+
+// decodeHex decodes h, the hex digits of s, which should have n bytes. Errors quote s.
+func decodeHex(s, h string, n int, name string) ([]byte, error) {
+	b, err := hex.DecodeString(h)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %v", name, s, err)
+	}
+	if len(b) != n {
+		return nil, fmt.Errorf("invalid %s %q: should have %d bytes, got %d", name, s, n, len(b))
+	}
+	return b, nil
+}
@@ -0,0 +1,132 @@
+package lcstypes
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/the729/lcs"
+)
+
+func hexMustDecode(s string) []byte {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+type testTransaction struct {
+	Sender    AccountAddress
+	Module    Identifier
+	Signers   BitVec
+	PublicKey Ed25519PublicKey
+	Signature Ed25519Signature
+	Hash      HashValue
+}
+
+func testTransactionValue() *testTransaction {
+	tx := &testTransaction{Module: "LibraAccount"}
+	tx.Sender, _ = ParseAccountAddress("0xa550c18")
+	tx.Signers.Set(0)
+	tx.Signers.Set(9)
+	for i := range tx.PublicKey {
+		tx.PublicKey[i] = 0x11
+	}
+	for i := range tx.Signature {
+		tx.Signature[i] = 0x22
+	}
+	tx.Hash[31] = 0xff
+	return tx
+}
+
+func TestEncoding(t *testing.T) {
+	tx := testTransactionValue()
+	b, err := lcs.Marshal(tx)
+	assert.NoError(t, err)
+	expected := hexMustDecode("0000000000000000000000000a550c18" +
+		"0c 4c696272614163636f756e74" +
+		"02 8040" +
+		"20" + strings.Repeat("11", 32) +
+		"40" + strings.Repeat("22", 64) +
+		"20" + strings.Repeat("00", 31) + "ff")
+	assert.Equal(t, expected, b)
+
+	out := &testTransaction{}
+	assert.NoError(t, lcs.Unmarshal(b, out))
+	assert.Equal(t, tx, out)
+	assert.True(t, out.Signers.IsSet(9))
+	assert.False(t, out.Signers.IsSet(8))
+	assert.Equal(t, 2, out.Signers.CountOnes())
+}
+
+func TestAddressLength(t *testing.T) {
+	defer func(n int) { AddressLength = n }(AddressLength)
+	AddressLength = 32
+
+	a, err := ParseAccountAddress("0x1")
+	assert.NoError(t, err)
+	b, err := lcs.Marshal(a)
+	assert.NoError(t, err)
+	assert.Equal(t, hexMustDecode(strings.Repeat("00", 31)+"01"), b)
+
+	var out AccountAddress
+	assert.NoError(t, lcs.Unmarshal(b, &out))
+	assert.Equal(t, a, out)
+
+	_, err = lcs.Marshal(AccountAddress(make([]byte, 16)))
+	assert.EqualError(t, err, "address should have 32 bytes, got 16")
+}
+
+func TestValidation(t *testing.T) {
+	for _, id := range []Identifier{"", "_", "1abc", "a-b", "ñ"} {
+		assert.Error(t, id.Validate(), id)
+		_, err := lcs.Marshal(id)
+		assert.Error(t, err, id)
+	}
+	for _, id := range []Identifier{"a", "_a", "Coin1", "a_b_1"} {
+		assert.NoError(t, id.Validate(), id)
+	}
+	var id Identifier
+	assert.EqualError(t, lcs.Unmarshal(hexMustDecode("02 312e"), &id), `invalid identifier "1."`)
+
+	var bv BitVec
+	assert.EqualError(t, lcs.Unmarshal(hexMustDecode("02 8000"), &bv), "bit vector has trailing zero bytes")
+	assert.EqualError(t, lcs.Unmarshal(hexMustDecode("21"+strings.Repeat("01", 33)), &bv),
+		"bit vector should have at most 32 bytes, got 33")
+	bv = nil
+	bv.Set(255)
+	assert.Len(t, bv, 32)
+	assert.NoError(t, bv.Validate())
+	bv.Unset(255)
+	assert.Len(t, bv, 0)
+
+	var k Ed25519PublicKey
+	assert.EqualError(t, lcs.Unmarshal(hexMustDecode("02 1111"), &k),
+		"lcstypes.Ed25519PublicKey should have 32 bytes, got 2")
+	_, err := ParseEd25519Signature("0x1122")
+	assert.EqualError(t, err, `invalid signature "0x1122": should have 64 bytes, got 2`)
+	_, err = ParseAccountAddress("0xg")
+	assert.EqualError(t, err, `invalid address "0xg": encoding/hex: invalid byte: U+0067 'g'`)
+	_, err = ParseAccountAddress("01")
+	assert.EqualError(t, err, `invalid address "01": should have 16 bytes, got 1`)
+}
+
+func TestJSON(t *testing.T) {
+	tx := testTransactionValue()
+	b, err := json.Marshal(tx)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Sender":"0000000000000000000000000a550c18","Module":"LibraAccount","Signers":"8040",`+
+		`"PublicKey":"`+strings.Repeat("11", 32)+`","Signature":"`+strings.Repeat("22", 64)+`",`+
+		`"Hash":"`+strings.Repeat("00", 31)+`ff"}`, string(b))
+
+	out := &testTransaction{}
+	assert.NoError(t, json.Unmarshal(b, out))
+	assert.Equal(t, tx, out)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"Module":"a b"}`), out))
+	assert.Error(t, json.Unmarshal([]byte(`{"Signers":"00"}`), out))
+	assert.Error(t, json.Unmarshal([]byte(`{"Hash":"0x00"}`), out))
+}
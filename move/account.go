@@ -0,0 +1,71 @@
+package move
+
+import (
+	"fmt"
+
+	"github.com/the729/lcs"
+)
+
+// ResourceTag is the first byte of the access paths of resources.
+const ResourceTag = 1
+
+// ResourcePath returns the access path of the resource of type tag in an account, which is
+// ResourceTag followed by the encoded struct tag.
+func ResourcePath(tag *StructTag) ([]byte, error) {
+	b, err := lcs.Marshal(*tag)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{ResourceTag}, b...), nil
+}
+
+// Resource is a resource in an account state.
+type Resource struct {
+	Tag *StructTag
+	// Value is the resource decoded as the type registered for its tag with
+	// lcs.RegisterTaggedType, or nil if no type is registered.
+	Value interface{}
+	// Data is the encoded resource.
+	Data []byte
+}
+
+// DecodeAccountState decodes the resources in blob, an encoded account state, i.e.
+// BTreeMap<Vec<u8>, Vec<u8>> from access paths to encoded values. Resources whose tags are
+// registered with lcs.RegisterTaggedType are decoded with opts, such as
+// lcs.DecoderOptions{Registry: Registry}. Values at other access paths, such as modules, are
+// skipped.
+//
+// The resources are in wire order. Entries out of canonical order or duplicated are kept
+// as they are; use lcs.VerifyCanonical to reject them.
+func DecodeAccountState(blob []byte, opts lcs.DecoderOptions) ([]*Resource, error) {
+	var state struct {
+		Entries []struct {
+			Path  []byte
+			Value []byte
+		} `lcs:"map"`
+	}
+	if err := lcs.Unmarshal(blob, &state); err != nil {
+		return nil, err
+	}
+
+	resources := make([]*Resource, 0, len(state.Entries))
+	for _, e := range state.Entries {
+		if len(e.Path) == 0 || e.Path[0] != ResourceTag {
+			continue
+		}
+		r := &Resource{Tag: new(StructTag), Data: e.Value}
+		if err := lcs.Unmarshal(e.Path[1:], r.Tag); err != nil {
+			return nil, err
+		}
+		tag := r.Tag.String()
+		if _, ok := lcs.TaggedType(tag); ok {
+			v, err := lcs.DecodeTaggedWithOptions(tag, r.Data, opts)
+			if err != nil {
+				return nil, fmt.Errorf("resource %s: %v", tag, err)
+			}
+			r.Value = v
+		}
+		resources = append(resources, r)
+	}
+	return resources, nil
+}
@@ -0,0 +1,284 @@
+// Package move decodes Move values stored as LCS blobs, whose structure is defined by type
+// layouts at runtime rather than Go types.
+package move
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/the729/lcs"
+	"github.com/the729/lcs/lcstypes"
+)
+
+// Kind is the kind of a Layout.
+type Kind int
+
+// Kinds of layouts.
+const (
+	Bool Kind = iota
+	U8
+	U64
+	U128
+	Address
+	Signer
+	Vector
+	Struct
+)
+
+var kindNames = []string{"bool", "u8", "u64", "u128", "address", "signer", "vector", "struct"}
+
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return "Kind(" + strconv.Itoa(int(k)) + ")"
+	}
+	return kindNames[k]
+}
+
+// Layout is the runtime type layout of a Move value, i.e. MoveTypeLayout.
+type Layout struct {
+	Kind Kind
+	// Elem is the layout of the elements of a vector.
+	Elem *Layout
+	// Name is the struct tag of a struct, such as "0x1::Coin::Coin<0x1::XUS::XUS>". It is
+	// optional. ParseLayout stores it in the canonical form of StructTag.String.
+	Name string
+	// Fields are the fields of a struct, in order.
+	Fields []Field
+}
+
+// Field is a field of a struct layout.
+type Field struct {
+	Name   string
+	Layout *Layout
+}
+
+// String returns the layout in the syntax of ParseLayout.
+func (l *Layout) String() string {
+	switch l.Kind {
+	case Vector:
+		return "vector<" + l.Elem.String() + ">"
+	case Struct:
+		fields := make([]string, len(l.Fields))
+		for i, f := range l.Fields {
+			fields[i] = f.Name + ": " + f.Layout.String()
+		}
+		s := "{" + strings.Join(fields, ", ") + "}"
+		if l.Name != "" {
+			s = l.Name + " " + s
+		}
+		return s
+	}
+	return l.Kind.String()
+}
+
+// Type returns a Go type with the same LCS encoding as values of the layout. Structs are
+// unnamed Go structs with fields F0, F1..., addresses are byte arrays of
+// lcstypes.AddressLength, and u128 values are *big.Int, which needs the codec in Registry.
+func (l *Layout) Type() (reflect.Type, error) {
+	switch l.Kind {
+	case Bool:
+		return reflect.TypeOf(false), nil
+	case U8:
+		return reflect.TypeOf(uint8(0)), nil
+	case U64:
+		return reflect.TypeOf(uint64(0)), nil
+	case U128:
+		return reflect.TypeOf((*big.Int)(nil)), nil
+	case Address, Signer:
+		return reflect.ArrayOf(lcstypes.AddressLength, reflect.TypeOf(byte(0))), nil
+	case Vector:
+		if l.Elem == nil {
+			return nil, errors.New("vector layout without element layout")
+		}
+		elem, err := l.Elem.Type()
+		if err != nil {
+			return nil, err
+		}
+		return reflect.SliceOf(elem), nil
+	case Struct:
+		fields := make([]reflect.StructField, len(l.Fields))
+		for i, f := range l.Fields {
+			if f.Layout == nil {
+				return nil, errors.New("struct field " + f.Name + " without layout")
+			}
+			t, err := f.Layout.Type()
+			if err != nil {
+				return nil, err
+			}
+			fields[i] = reflect.StructField{Name: "F" + strconv.Itoa(i), Type: t}
+		}
+		return reflect.StructOf(fields), nil
+	}
+	return nil, fmt.Errorf("unknown layout kind %s", l.Kind)
+}
+
+// Registry holds the codec of u128 values, i.e. *big.Int, and the codecs of the lcstypes
+// types, which resources registered with lcs.RegisterTaggedType can use.
+var Registry = lcs.NewRegistry()
+
+func init() {
+	Registry.RegisterBigIntCodec(128)
+	lcstypes.RegisterCodecs(Registry)
+}
+
+// MarshalJSON encodes the layout as JSON: primitive layouts are strings such as "u64",
+// vectors are {"vector": elem}, and structs are
+// {"struct": {"name": "0x1::Coin::Coin", "fields": [{"name": "value", "type": "u64"}]}}.
+func (l *Layout) MarshalJSON() ([]byte, error) {
+	switch l.Kind {
+	case Vector:
+		return json.Marshal(map[string]*Layout{"vector": l.Elem})
+	case Struct:
+		type jsonField struct {
+			Name string  `json:"name"`
+			Type *Layout `json:"type"`
+		}
+		s := struct {
+			Name   string      `json:"name,omitempty"`
+			Fields []jsonField `json:"fields"`
+		}{Name: l.Name, Fields: make([]jsonField, len(l.Fields))}
+		for i, f := range l.Fields {
+			s.Fields[i] = jsonField{Name: f.Name, Type: f.Layout}
+		}
+		return json.Marshal(map[string]interface{}{"struct": s})
+	}
+	return json.Marshal(l.Kind.String())
+}
+
+// UnmarshalJSON decodes the layout from JSON, in the format of MarshalJSON.
+func (l *Layout) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		k, ok := primitiveKind(name)
+		if !ok {
+			return fmt.Errorf("unknown layout %q", name)
+		}
+		*l = Layout{Kind: k}
+		return nil
+	}
+	var m struct {
+		Vector *Layout `json:"vector"`
+		Struct *struct {
+			Name   string `json:"name"`
+			Fields []struct {
+				Name string  `json:"name"`
+				Type *Layout `json:"type"`
+			} `json:"fields"`
+		} `json:"struct"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	switch {
+	case m.Vector != nil:
+		*l = Layout{Kind: Vector, Elem: m.Vector}
+	case m.Struct != nil:
+		*l = Layout{Kind: Struct, Name: m.Struct.Name, Fields: make([]Field, len(m.Struct.Fields))}
+		for i, f := range m.Struct.Fields {
+			if f.Type == nil {
+				return fmt.Errorf("struct field %s without type", f.Name)
+			}
+			l.Fields[i] = Field{Name: f.Name, Layout: f.Type}
+		}
+	default:
+		return errors.New("layout should be a string, or an object with vector or struct")
+	}
+	return nil
+}
+
+func primitiveKind(name string) (Kind, bool) {
+	for k := Bool; k <= Signer; k++ {
+		if kindNames[k] == name {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
+// ParseLayout parses a layout in the Move type syntax, extended with struct fields:
+//
+//	bool, u8, u64, u128, address, signer, vector<T>
+//	0x1::Coin::Coin<0x1::XUS::XUS> {value: u64}
+//
+// The struct tag before the fields of a struct is optional.
+func ParseLayout(s string) (*Layout, error) {
+	p := &parser{what: "layout", s: s}
+	l, err := p.layout()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.end(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (p *parser) layout() (*Layout, error) {
+	if p.accept("{") {
+		return p.fields("")
+	}
+	name := p.token()
+	if k, ok := primitiveKind(name); ok {
+		return &Layout{Kind: k}, nil
+	}
+	if name == "vector" {
+		if err := p.expect("<"); err != nil {
+			return nil, err
+		}
+		elem, err := p.layout()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(">"); err != nil {
+			return nil, err
+		}
+		return &Layout{Kind: Vector, Elem: elem}, nil
+	}
+	if name == "" {
+		return nil, p.errorf("expected layout")
+	}
+	// a struct tag, followed by the fields
+	if !strings.HasPrefix(name, "0x") {
+		return nil, fmt.Errorf("unknown layout %q", name)
+	}
+	tag, err := p.structTag(name)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expect("{"); err != nil {
+		return nil, err
+	}
+	return p.fields(tag.String())
+}
+
+func (p *parser) fields(name string) (*Layout, error) {
+	l := &Layout{Kind: Struct, Name: name}
+	for !p.accept("}") {
+		if len(l.Fields) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			if p.accept("}") {
+				break
+			}
+		}
+		fname := p.token()
+		if fname == "" {
+			return nil, p.errorf("expected field name")
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		fl, err := p.layout()
+		if err != nil {
+			return nil, err
+		}
+		l.Fields = append(l.Fields, Field{Name: fname, Layout: fl})
+	}
+	return l, nil
+}
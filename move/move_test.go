@@ -0,0 +1,172 @@
+package move
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/the729/lcs"
+	"github.com/the729/lcs/lcstypes"
+)
+
+func hexMustDecode(s string) []byte {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+const balanceLayout = "0x1::LibraAccount::Balance<0x1::Coin1::Coin1> {coin: 0x1::Libra::Libra<0x1::Coin1::Coin1> {value: u64}}"
+
+func TestParseLayout(t *testing.T) {
+	cases := []struct {
+		s, expected, err string
+	}{
+		{s: "u64", expected: "u64"},
+		{s: " vector< vector<u8> > ", expected: "vector<vector<u8>>"},
+		{s: balanceLayout, expected: balanceLayout},
+		{s: "{a: bool, b: u128, c: signer,}", expected: "{a: bool, b: u128, c: signer}"},
+		{s: "0x1::M::S<0x1::A::A,u8> {x: address}", expected: "0x1::M::S<0x1::A::A, u8> {x: address}"},
+		{s: "0x01::M::S {x: u8}", expected: "0x1::M::S {x: u8}"},
+		{s: "0x1::M::1S {x: u8}", err: `layout at 8: invalid identifier "1S"`},
+		{s: "u16", err: `unknown layout "u16"`},
+		{s: "vector<u8", err: `layout at 9: expected ">"`},
+		{s: "{a u8}", err: `layout at 3: expected ":"`},
+		{s: "u8 u8", err: `layout at 3: unexpected "u8"`},
+		{s: "vector<0x1::M::S>", err: `layout at 16: expected "{"`},
+		{s: "0x1::M::S<u8 {x: u8}", err: `layout at 13: expected ","`},
+	}
+	for _, c := range cases {
+		l, err := ParseLayout(c.s)
+		if c.err != "" {
+			assert.EqualError(t, err, c.err, c.s)
+			continue
+		}
+		if assert.NoError(t, err, c.s) {
+			assert.Equal(t, c.expected, l.String(), c.s)
+		}
+	}
+}
+
+func TestLayoutJSON(t *testing.T) {
+	l, err := ParseLayout(balanceLayout)
+	assert.NoError(t, err)
+	b, err := json.Marshal(l)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"struct":{"name":"0x1::LibraAccount::Balance\u003c0x1::Coin1::Coin1\u003e","fields":[`+
+		`{"name":"coin","type":{"struct":{"name":"0x1::Libra::Libra\u003c0x1::Coin1::Coin1\u003e","fields":[`+
+		`{"name":"value","type":"u64"}]}}}]}}`, string(b))
+	var l2 Layout
+	assert.NoError(t, json.Unmarshal(b, &l2))
+	assert.Equal(t, l, &l2)
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"vector":"address"}`), &l2))
+	assert.Equal(t, "vector<address>", l2.String())
+	assert.EqualError(t, json.Unmarshal([]byte(`"u16"`), &l2), `unknown layout "u16"`)
+	assert.EqualError(t, json.Unmarshal([]byte(`{}`), &l2), "layout should be a string, or an object with vector or struct")
+}
+
+func TestDecodeMoveValue(t *testing.T) {
+	l, err := ParseLayout("{authentication_key: vector<u8>, sent: u64, owner: address, " +
+		"big: u128, frozen: bool, tags: vector<{id: u8}>}")
+	assert.NoError(t, err)
+	data := hexMustDecode("02 aabb 0700000000000000 000000000000000000000000000000a1" +
+		"ffffffffffffffffffffffffffffffff 01 02 01 02")
+	v, err := DecodeMoveValue(data, l)
+	assert.NoError(t, err)
+	b, err := json.Marshal(v)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"authentication_key":"0xaabb","sent":"7","owner":"0x000000000000000000000000000000a1",`+
+		`"big":"340282366920938463463374607431768211455","frozen":true,"tags":[{"id":1},{"id":2}]}`, string(b))
+
+	_, err = DecodeMoveValue(data[:10], l)
+	assert.EqualError(t, err, "unexpected EOF")
+}
+
+func TestSplitFunc(t *testing.T) {
+	l, err := ParseLayout("{a: vector<u64>, b: bool}")
+	assert.NoError(t, err)
+	split, err := SplitFunc(l)
+	assert.NoError(t, err)
+	s := bufio.NewScanner(bytes.NewReader(hexMustDecode("01 0100000000000000 01 00 00")))
+	s.Split(split)
+	var tokens []string
+	for s.Scan() {
+		tokens = append(tokens, hex.EncodeToString(s.Bytes()))
+	}
+	assert.NoError(t, s.Err())
+	assert.Equal(t, []string{"01010000000000000001", "0000"}, tokens)
+}
+
+func TestDecodeAccountState(t *testing.T) {
+	type coin struct {
+		Value uint64
+	}
+	type generator struct {
+		Counter uint64
+		Addr    lcstypes.AccountAddress
+	}
+	lcs.RegisterTaggedType("0x1::Libra::Libra<0x1::Coin1::Coin1>", coin{})
+	lcs.RegisterTaggedType("0x1::Event::EventHandleGenerator", generator{})
+
+	state := make(map[string][]byte)
+	for tag, data := range map[string]string{
+		"0x1::Libra::Libra<0x1::Coin1::Coin1>":   "6400000000000000",
+		"0x1::Event::EventHandleGenerator":       "0200000000000000 0000000000000000000000000a550c18",
+		"0x1::Libra::Preburn<0x1::Coin1::Coin1>": "00",
+	} {
+		st, err := ParseStructTag(tag)
+		assert.NoError(t, err)
+		path, err := ResourcePath(st)
+		assert.NoError(t, err)
+		state[string(path)] = hexMustDecode(data)
+	}
+	state["\x00module"] = []byte{0xa1}
+	blob, err := lcs.Marshal(state)
+	assert.NoError(t, err)
+
+	resources, err := DecodeAccountState(blob, lcs.DecoderOptions{Registry: Registry})
+	assert.NoError(t, err)
+	if assert.Len(t, resources, 3) {
+		// the address is decoded with the lcstypes codec in Registry
+		addr, _ := lcstypes.ParseAccountAddress("0xa550c18")
+		assert.Equal(t, "0x1::Event::EventHandleGenerator", resources[0].Tag.String())
+		assert.Equal(t, generator{Counter: 2, Addr: addr}, resources[0].Value)
+		assert.Equal(t, "0x1::Libra::Libra<0x1::Coin1::Coin1>", resources[1].Tag.String())
+		assert.Equal(t, coin{Value: 100}, resources[1].Value)
+		assert.Equal(t, "0x1::Libra::Preburn<0x1::Coin1::Coin1>", resources[2].Tag.String())
+		assert.Nil(t, resources[2].Value)
+		assert.Equal(t, hexMustDecode("00"), resources[2].Data)
+	}
+
+	// entries are kept in wire order, even out of canonical order or duplicated
+	type entry struct {
+		Path, Value []byte
+	}
+	coinTag, _ := ParseStructTag("0x1::Libra::Libra<0x1::Coin1::Coin1>")
+	coinPath, _ := ResourcePath(coinTag)
+	preburnTag, _ := ParseStructTag("0x1::Libra::Preburn<0x1::Coin1::Coin1>")
+	preburnPath, _ := ResourcePath(preburnTag)
+	blob, err = lcs.Marshal([]entry{
+		{Path: preburnPath, Value: []byte{0x00}},
+		{Path: coinPath, Value: hexMustDecode("0100000000000000")},
+		{Path: coinPath, Value: hexMustDecode("0200000000000000")},
+	})
+	assert.NoError(t, err)
+	resources, err = DecodeAccountState(blob, lcs.DecoderOptions{})
+	assert.NoError(t, err)
+	if assert.Len(t, resources, 3) {
+		assert.Equal(t, "0x1::Libra::Preburn<0x1::Coin1::Coin1>", resources[0].Tag.String())
+		assert.Equal(t, coin{Value: 1}, resources[1].Value)
+		assert.Equal(t, coin{Value: 2}, resources[2].Value)
+	}
+
+	blob, _ = lcs.Marshal(map[string][]byte{string(coinPath): {0x64}})
+	_, err = DecodeAccountState(blob, lcs.DecoderOptions{})
+	assert.EqualError(t, err, "resource 0x1::Libra::Libra<0x1::Coin1::Coin1>: unexpected EOF")
+}
@@ -0,0 +1,77 @@
+package move
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/the729/lcs/lcstypes"
+)
+
+// parser is a cursor over text in the Move type syntax, shared by ParseTypeTag and
+// ParseLayout. Errors are prefixed with what is parsed and the current position.
+type parser struct {
+	what string
+	s    string
+	pos  int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s at %d: %s", p.what, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.s) && unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+// token returns the next word of letters, digits and underscores, or an empty string if
+// there is none.
+func (p *parser) token() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if c != '_' && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9') {
+			break
+		}
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *parser) accept(sep string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.s[p.pos:], sep) {
+		p.pos += len(sep)
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(sep string) error {
+	if !p.accept(sep) {
+		return p.errorf("expected %q", sep)
+	}
+	return nil
+}
+
+// end returns an error if there is more than whitespace left.
+func (p *parser) end() error {
+	if p.skipSpace(); p.pos != len(p.s) {
+		return p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	return nil
+}
+
+func (p *parser) identifier() (lcstypes.Identifier, error) {
+	p.skipSpace()
+	start := p.pos
+	id := lcstypes.Identifier(p.token())
+	if err := id.Validate(); err != nil {
+		p.pos = start
+		return "", p.errorf("%v", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,193 @@
+package move
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/the729/lcs"
+	"github.com/the729/lcs/lcstypes"
+)
+
+// TypeTag is a Move type. It is an enum of TypeTagBool, TypeTagU8, TypeTagU64, TypeTagU128,
+// TypeTagAddress, TypeTagSigner, TypeTagVector and *StructTag, in this order.
+type TypeTag interface {
+	isTypeTag()
+	String() string
+}
+
+// The primitive variants of TypeTag, which have no data.
+type (
+	TypeTagBool    struct{}
+	TypeTagU8      struct{}
+	TypeTagU64     struct{}
+	TypeTagU128    struct{}
+	TypeTagAddress struct{}
+	TypeTagSigner  struct{}
+)
+
+// TypeTagVector is the TypeTag of vectors of Elem.
+type TypeTagVector struct {
+	Elem TypeTag
+}
+
+// StructTag is a Move struct type, e.g. 0x1::Coin::Coin<0x1::XUS::XUS>.
+type StructTag struct {
+	Address    lcstypes.AccountAddress
+	Module     lcstypes.Identifier
+	Name       lcstypes.Identifier
+	TypeParams []TypeTag
+}
+
+func (TypeTagBool) isTypeTag()    {}
+func (TypeTagU8) isTypeTag()      {}
+func (TypeTagU64) isTypeTag()     {}
+func (TypeTagU128) isTypeTag()    {}
+func (TypeTagAddress) isTypeTag() {}
+func (TypeTagSigner) isTypeTag()  {}
+func (TypeTagVector) isTypeTag()  {}
+func (*StructTag) isTypeTag()     {}
+
+func (TypeTagBool) String() string     { return "bool" }
+func (TypeTagU8) String() string       { return "u8" }
+func (TypeTagU64) String() string      { return "u64" }
+func (TypeTagU128) String() string     { return "u128" }
+func (TypeTagAddress) String() string  { return "address" }
+func (TypeTagSigner) String() string   { return "signer" }
+func (t TypeTagVector) String() string { return "vector<" + t.Elem.String() + ">" }
+
+// String returns the canonical form of the struct tag, e.g. "0x1::Coin::Coin<0x1::XUS::XUS>".
+func (t *StructTag) String() string {
+	s := formatAddress(t.Address) + "::" + string(t.Module) + "::" + string(t.Name)
+	if len(t.TypeParams) > 0 {
+		params := make([]string, len(t.TypeParams))
+		for i, p := range t.TypeParams {
+			params[i] = p.String()
+		}
+		s += "<" + strings.Join(params, ", ") + ">"
+	}
+	return s
+}
+
+// formatAddress returns the address in hex with 0x prefix, without leading zeros, e.g. "0x1".
+func formatAddress(a lcstypes.AccountAddress) string {
+	s := strings.TrimLeft(hex.EncodeToString(a), "0")
+	if s == "" {
+		s = "0"
+	}
+	return "0x" + s
+}
+
+func init() {
+	lcs.RegisterEnum((*TypeTag)(nil),
+		TypeTagBool{},
+		TypeTagU8{},
+		TypeTagU64{},
+		TypeTagU128{},
+		TypeTagAddress{},
+		TypeTagSigner{},
+		TypeTagVector{},
+		(*StructTag)(nil),
+	)
+}
+
+var primitiveTypeTags = map[string]TypeTag{
+	"bool":    TypeTagBool{},
+	"u8":      TypeTagU8{},
+	"u64":     TypeTagU64{},
+	"u128":    TypeTagU128{},
+	"address": TypeTagAddress{},
+	"signer":  TypeTagSigner{},
+}
+
+// ParseTypeTag parses a type tag, such as "u64", "vector<u8>" or
+// "0x1::Coin::Coin<0x1::XUS::XUS>".
+func ParseTypeTag(s string) (TypeTag, error) {
+	p := &parser{what: "type tag", s: s}
+	t, err := p.typeTag()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.end(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ParseStructTag parses a struct tag, such as "0x1::Coin::Coin<0x1::XUS::XUS>".
+func ParseStructTag(s string) (*StructTag, error) {
+	t, err := ParseTypeTag(s)
+	if err != nil {
+		return nil, err
+	}
+	st, ok := t.(*StructTag)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a struct tag", s)
+	}
+	return st, nil
+}
+
+func (p *parser) typeTag() (TypeTag, error) {
+	word := p.token()
+	if t, ok := primitiveTypeTags[word]; ok {
+		return t, nil
+	}
+	if word == "vector" {
+		if err := p.expect("<"); err != nil {
+			return nil, err
+		}
+		elem, err := p.typeTag()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(">"); err != nil {
+			return nil, err
+		}
+		return TypeTagVector{Elem: elem}, nil
+	}
+	if word == "" {
+		return nil, p.errorf("expected type tag")
+	}
+	return p.structTag(word)
+}
+
+// structTag parses the rest of a struct tag, after its address word.
+func (p *parser) structTag(word string) (*StructTag, error) {
+	// addresses have the 0x prefix, and leading zeros can be omitted
+	if !strings.HasPrefix(word, "0x") || len(word) == 2 {
+		return nil, fmt.Errorf("invalid address %q", word)
+	}
+	addr, err := lcstypes.ParseAccountAddress(word)
+	if err != nil {
+		return nil, err
+	}
+	t := &StructTag{Address: addr}
+	if err = p.expect("::"); err != nil {
+		return nil, err
+	}
+	if t.Module, err = p.identifier(); err != nil {
+		return nil, err
+	}
+	if err = p.expect("::"); err != nil {
+		return nil, err
+	}
+	if t.Name, err = p.identifier(); err != nil {
+		return nil, err
+	}
+	if !p.accept("<") {
+		return t, nil
+	}
+	for {
+		param, err := p.typeTag()
+		if err != nil {
+			return nil, err
+		}
+		t.TypeParams = append(t.TypeParams, param)
+		if p.accept(">") {
+			return t, nil
+		}
+		if err = p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
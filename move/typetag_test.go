@@ -0,0 +1,108 @@
+package move
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/the729/lcs"
+	"github.com/the729/lcs/lcstypes"
+)
+
+func TestTypeTag(t *testing.T) {
+	assert.NoError(t, lcs.Check(reflect.TypeOf((*TypeTag)(nil)).Elem()))
+
+	cases := []struct {
+		s, expected, encoded string
+	}{
+		{s: "bool", encoded: "00"},
+		{s: "u8", encoded: "01"},
+		{s: "u64", encoded: "02"},
+		{s: "u128", encoded: "03"},
+		{s: "address", encoded: "04"},
+		{s: "signer", encoded: "05"},
+		{s: "vector<vector<u8>>", encoded: "06 06 01"},
+		{s: "vector<\r\n\vu8>", expected: "vector<u8>", encoded: "06 01"},
+		{
+			s:       "0x1::LBR::LBR",
+			encoded: "07 00000000000000000000000000000001 03 4c4252 03 4c4252 00",
+		},
+		{
+			s:       "0x1::Coin::Coin<0x1::XUS::XUS>",
+			encoded: "07 00000000000000000000000000000001 04 436f696e 04 436f696e 01 07 00000000000000000000000000000001 03 585553 03 585553 00",
+		},
+		{
+			s:        " 0x0A550C18 :: M :: Pair < vector<address> ,0x1::A::B_1<u64> > ",
+			expected: "0xa550c18::M::Pair<vector<address>, 0x1::A::B_1<u64>>",
+			encoded: "07 0000000000000000000000000a550c18 01 4d 04 50616972 02 06 04" +
+				" 07 00000000000000000000000000000001 01 41 03 425f31 01 02",
+		},
+	}
+	for _, c := range cases {
+		if c.expected == "" {
+			c.expected = c.s
+		}
+		tag, err := ParseTypeTag(c.s)
+		if !assert.NoError(t, err, c.s) {
+			continue
+		}
+		b, err := lcs.Marshal(&tag)
+		if !assert.NoError(t, err, c.s) {
+			continue
+		}
+		assert.Equal(t, hexMustDecode(c.encoded), b, c.s)
+
+		var decoded TypeTag
+		if assert.NoError(t, lcs.Unmarshal(b, &decoded), c.s) {
+			assert.Equal(t, c.expected, decoded.String(), c.s)
+			b2, err := lcs.Marshal(&decoded)
+			assert.NoError(t, err, c.s)
+			assert.Equal(t, b, b2, c.s)
+		}
+	}
+}
+
+func TestTypeTagAddressLength(t *testing.T) {
+	defer func(n int) { lcstypes.AddressLength = n }(lcstypes.AddressLength)
+	lcstypes.AddressLength = 32
+
+	tag, err := ParseTypeTag("0x1::M::S")
+	assert.NoError(t, err)
+	b, err := lcs.Marshal(&tag)
+	assert.NoError(t, err)
+	assert.Equal(t, hexMustDecode("07"+strings.Repeat("00", 31)+"01 01 4d 01 53 00"), b)
+	var decoded TypeTag
+	assert.NoError(t, lcs.Unmarshal(b, &decoded))
+	assert.Equal(t, "0x1::M::S", decoded.String())
+
+	l, err := ParseLayout("{a: address}")
+	assert.NoError(t, err)
+	typ, err := l.Type()
+	assert.NoError(t, err)
+	assert.Equal(t, 32, typ.Field(0).Type.Len())
+}
+
+func TestParseTypeTagErrors(t *testing.T) {
+	cases := []struct {
+		s, err string
+	}{
+		{s: "", err: "type tag at 0: expected type tag"},
+		{s: "u16", err: `invalid address "u16"`},
+		{s: "vector<u8", err: `type tag at 9: expected ">"`},
+		{s: "0x1::M", err: `type tag at 6: expected "::"`},
+		{s: "0x1::M::_", err: `type tag at 8: invalid identifier "_"`},
+		{s: "0x1::M::S<u8 u8>", err: `type tag at 13: expected ","`},
+		{s: "0x1::M::S<>", err: "type tag at 10: expected type tag"},
+		{s: "0x::M::S", err: `invalid address "0x"`},
+		{s: "0xg::M::S", err: `invalid address "0xg": encoding/hex: invalid byte: U+0067 'g'`},
+		{s: "0x" + "0000000000000000000000000000000001::M::S", err: `invalid address "0x0000000000000000000000000000000001": should have 16 bytes, got 17`},
+		{s: "u8 u8", err: `type tag at 3: unexpected "u8"`},
+	}
+	for _, c := range cases {
+		_, err := ParseTypeTag(c.s)
+		assert.EqualError(t, err, c.err, c.s)
+	}
+	_, err := ParseStructTag("vector<u8>")
+	assert.EqualError(t, err, "vector<u8> is not a struct tag")
+}
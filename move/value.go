@@ -0,0 +1,122 @@
+package move
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strconv"
+
+	"github.com/the729/lcs"
+)
+
+// Value is a decoded Move value, annotated with its layout.
+type Value struct {
+	Layout *Layout
+	// Data is a bool, uint8, uint64, *big.Int or []byte for bool, u8, u64, u128, address and
+	// signer values. It is []*Value of the elements or the fields for vectors and structs.
+	Data interface{}
+}
+
+// DecodeMoveValue decodes data, an encoded Move value of the layout.
+func DecodeMoveValue(data []byte, layout *Layout) (*Value, error) {
+	t, err := layout.Type()
+	if err != nil {
+		return nil, err
+	}
+	rv := reflect.New(t)
+	if err = lcs.UnmarshalWithOptions(data, rv.Interface(), lcs.DecoderOptions{Registry: Registry}); err != nil {
+		return nil, err
+	}
+	return newValue(rv.Elem(), layout), nil
+}
+
+// newValue annotates rv, a decoded value of layout.Type(), with the layout.
+func newValue(rv reflect.Value, layout *Layout) *Value {
+	v := &Value{Layout: layout}
+	switch layout.Kind {
+	case Bool:
+		v.Data = rv.Bool()
+	case U8:
+		v.Data = uint8(rv.Uint())
+	case U64:
+		v.Data = rv.Uint()
+	case U128:
+		v.Data = rv.Interface().(*big.Int)
+	case Address, Signer:
+		b := make([]byte, rv.Len())
+		reflect.Copy(reflect.ValueOf(b), rv)
+		v.Data = b
+	case Vector:
+		elems := make([]*Value, rv.Len())
+		for i := range elems {
+			elems[i] = newValue(rv.Index(i), layout.Elem)
+		}
+		v.Data = elems
+	case Struct:
+		fields := make([]*Value, len(layout.Fields))
+		for i, f := range layout.Fields {
+			fields[i] = newValue(rv.Field(i), f.Layout)
+		}
+		v.Data = fields
+	}
+	return v
+}
+
+// MarshalJSON encodes the value as JSON. u64 and u128 values are strings, so that they do
+// not lose precision. Addresses and vector<u8> values are hex strings with 0x prefix. Structs
+// are objects with fields in order.
+func (v *Value) MarshalJSON() ([]byte, error) {
+	switch v.Layout.Kind {
+	case U64:
+		return json.Marshal(strconv.FormatUint(v.Data.(uint64), 10))
+	case U128:
+		return json.Marshal(v.Data.(*big.Int).String())
+	case Address, Signer:
+		return json.Marshal("0x" + hex.EncodeToString(v.Data.([]byte)))
+	case Vector:
+		elems := v.Data.([]*Value)
+		if v.Layout.Elem.Kind == U8 {
+			b := make([]byte, len(elems))
+			for i, e := range elems {
+				b[i] = e.Data.(uint8)
+			}
+			return json.Marshal("0x" + hex.EncodeToString(b))
+		}
+		if elems == nil {
+			elems = []*Value{}
+		}
+		return json.Marshal(elems)
+	case Struct:
+		var buf bytes.Buffer
+		buf.WriteByte('{')
+		for i, f := range v.Data.([]*Value) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			name, _ := json.Marshal(v.Layout.Fields[i].Name)
+			buf.Write(name)
+			buf.WriteByte(':')
+			b, err := f.MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(b)
+		}
+		buf.WriteByte('}')
+		return buf.Bytes(), nil
+	}
+	return json.Marshal(v.Data)
+}
+
+// SplitFunc returns a bufio.SplitFunc which splits the input into encoded Move values of the
+// layout. See lcs.SplitFunc.
+func SplitFunc(layout *Layout) (bufio.SplitFunc, error) {
+	t, err := layout.Type()
+	if err != nil {
+		return nil, err
+	}
+	return lcs.SplitFuncWithOptions(t, lcs.DecoderOptions{Registry: Registry}), nil
+}
@@ -0,0 +1,105 @@
+package lcs
+
+import (
+	"io"
+	"unsafe"
+)
+
+// decReader is the input of a Decoder.
+type decReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// sliceReader is a decReader over an in-memory byte slice. It avoids copying and
+// allocation when reading fixed size values.
+type sliceReader struct {
+	data []byte
+	off  int
+}
+
+func (r *sliceReader) Read(p []byte) (int, error) {
+	if r.off >= len(r.data) {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	n := copy(p, r.data[r.off:])
+	r.off += n
+	return n, nil
+}
+
+func (r *sliceReader) ReadByte() (byte, error) {
+	if r.off >= len(r.data) {
+		return 0, io.EOF
+	}
+	b := r.data[r.off]
+	r.off++
+	return b, nil
+}
+
+// next returns the next n bytes, which alias the underlying data. The errors are the same
+// as io.ReadFull.
+func (r *sliceReader) next(n int) ([]byte, error) {
+	remaining := len(r.data) - r.off
+	if n > remaining {
+		r.off = len(r.data)
+		if remaining == 0 {
+			return nil, io.EOF
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := r.data[r.off : r.off+n]
+	r.off += n
+	return b, nil
+}
+
+// byteReader is a decReader over an io.Reader without ReadByte. It reads a byte at a time
+// without buffering, so that nothing is read beyond the decoded values.
+type byteReader struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+func (r *byteReader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+func (r *byteReader) ReadByte() (byte, error) {
+	if _, err := io.ReadFull(r.r, r.buf[:]); err != nil {
+		return 0, err
+	}
+	return r.buf[0], nil
+}
+
+// teeReader is a decReader that writes to w what it reads from r.
+type teeReader struct {
+	r decReader
+	w io.ByteWriter
+}
+
+func (t *teeReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	for _, b := range p[:n] {
+		t.w.WriteByte(b)
+	}
+	return n, err
+}
+
+func (t *teeReader) ReadByte() (byte, error) {
+	b, err := t.r.ReadByte()
+	if err == nil {
+		t.w.WriteByte(b)
+	}
+	return b, err
+}
+
+// bytesToString returns a string sharing memory with b. The bytes must not be modified
+// afterwards.
+func bytesToString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return *(*string)(unsafe.Pointer(&b))
+}
@@ -0,0 +1,72 @@
+package lcs
+
+import (
+	"reflect"
+)
+
+// EncodeFunc encodes v, a value of the type it is registered for, with e.
+//
+// It usually converts v to a value of a supported type and calls e.Encode.
+type EncodeFunc func(e *Encoder, v reflect.Value) error
+
+// DecodeFunc decodes into v, a settable value of the type it is registered for, with d.
+//
+// It usually calls d.Decode with a value of a supported type, and then converts it into v.
+type DecodeFunc func(d *Decoder, v reflect.Value) error
+
+type typeCodec struct {
+	encode EncodeFunc
+	decode DecodeFunc
+}
+
+// Registry holds the custom codecs used by an Encoder or a Decoder.
+//
+// Registration is not safe for concurrent use with encoding or decoding. Register codecs
+// during initialization.
+type Registry struct {
+	codecs map[reflect.Type]typeCodec
+}
+
+// DefaultRegistry is the registry used when no registry is set in the options.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		codecs: make(map[reflect.Type]typeCodec),
+	}
+}
+
+// RegisterCodec registers a custom codec for type t, so that values of t are delegated to
+// encodeFn and decodeFn. It is useful for third-party types which cannot be changed, such
+// as time.Time or *big.Int. If a codec was registered for t, it will be overwriten.
+//
+// If t is a pointer type, the codec is also used for addressable values of its element type.
+//
+// This function panics on errors.
+func (r *Registry) RegisterCodec(t reflect.Type, encodeFn EncodeFunc, decodeFn DecodeFunc) {
+	if t == nil {
+		panic("codec type should not be nil")
+	}
+	if encodeFn == nil || decodeFn == nil {
+		panic("codec of " + t.String() + " should have both encode and decode functions")
+	}
+	r.codecs[t] = typeCodec{
+		encode: encodeFn,
+		decode: decodeFn,
+	}
+}
+
+// RegisterCodec registers a custom codec for type t in the DefaultRegistry.
+// See Registry.RegisterCodec for details.
+func RegisterCodec(t reflect.Type, encodeFn EncodeFunc, decodeFn DecodeFunc) {
+	DefaultRegistry.RegisterCodec(t, encodeFn, decodeFn)
+}
+
+func (r *Registry) codec(t reflect.Type) (typeCodec, bool) {
+	if r == nil || len(r.codecs) == 0 {
+		return typeCodec{}, false
+	}
+	c, ok := r.codecs[t]
+	return c, ok
+}
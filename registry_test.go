@@ -0,0 +1,191 @@
+package lcs
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterCodec(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterCodec(reflect.TypeOf(net.IP{}),
+		func(e *Encoder, v reflect.Value) error {
+			ip := v.Interface().(net.IP).To4()
+			if ip == nil {
+				return errors.New("not an IPv4 address")
+			}
+			var b [4]byte
+			copy(b[:], ip)
+			return e.Encode(b)
+		},
+		func(d *Decoder, v reflect.Value) error {
+			var b [4]byte
+			if err := d.Decode(&b); err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(net.IPv4(b[0], b[1], b[2], b[3])))
+			return nil
+		},
+	)
+	type MyStruct struct {
+		Addr net.IP
+		Port uint16
+	}
+
+	in := &MyStruct{Addr: net.IPv4(127, 0, 0, 1), Port: 80}
+	b, err := MarshalWithOptions(in, EncoderOptions{Registry: r})
+	assert.NoError(t, err)
+	assert.Equal(t, hexMustDecode("7f000001 5000"), b)
+
+	out := &MyStruct{}
+	err = UnmarshalWithOptions(b, out, DecoderOptions{Registry: r})
+	assert.NoError(t, err)
+	assert.Equal(t, in, out)
+
+	// the default registry does not know about the codec
+	b, err = Marshal(in)
+	assert.NoError(t, err)
+	assert.Equal(t, hexMustDecode("10 00000000000000000000ffff7f000001 5000"), b)
+}
+
+func TestBigIntCodec(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterBigIntCodec(128)
+	type MyStruct struct {
+		Amount *big.Int
+		Fee    *big.Int `lcs:"optional"`
+	}
+
+	in := &MyStruct{Amount: big.NewInt(0x1234)}
+	b, err := MarshalWithOptions(in, EncoderOptions{Registry: r})
+	assert.NoError(t, err)
+	assert.Equal(t, hexMustDecode("34120000000000000000000000000000 00"), b)
+
+	out := &MyStruct{}
+	err = UnmarshalWithOptions(b, out, DecoderOptions{Registry: r})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, in.Amount.Cmp(out.Amount))
+	assert.Nil(t, out.Fee)
+
+	max := new(big.Int).Lsh(big.NewInt(1), 128)
+	_, err = MarshalWithOptions(&MyStruct{Amount: max}, EncoderOptions{Registry: r})
+	assert.EqualError(t, err, "value 340282366920938463463374607431768211456 overflows u128")
+
+	_, err = MarshalWithOptions(&MyStruct{Amount: big.NewInt(-1)}, EncoderOptions{Registry: r})
+	assert.EqualError(t, err, "value -1 overflows u128")
+
+	// top level big.Int value
+	x := new(big.Int)
+	err = UnmarshalWithOptions(hexMustDecode("ffffffffffffffffffffffffffffffff"), x, DecoderOptions{Registry: r})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, x.Cmp(new(big.Int).Sub(max, big.NewInt(1))))
+	b, err = MarshalWithOptions(x, EncoderOptions{Registry: r})
+	assert.NoError(t, err)
+	assert.Equal(t, hexMustDecode("ffffffffffffffffffffffffffffffff"), b)
+
+	// a big.Int field of a struct passed by value is encoded through an addressable copy
+	type ByValue struct {
+		V big.Int
+		A uint8
+	}
+	c := ByValue{A: 9}
+	c.V.SetInt64(7)
+	b, err = MarshalWithOptions(c, EncoderOptions{Registry: r})
+	assert.NoError(t, err)
+	assert.Equal(t, hexMustDecode("07000000000000000000000000000000 09"), b)
+	var cOut ByValue
+	err = UnmarshalWithOptions(b, &cOut, DecoderOptions{Registry: r})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, cOut.V.Cmp(&c.V))
+	assert.Equal(t, uint8(9), cOut.A)
+}
+
+func TestTimeCodec(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterTimeCodec()
+
+	in := time.Date(2020, 1, 2, 3, 4, 5, 6007000, time.UTC)
+	b, err := MarshalWithOptions(in, EncoderOptions{Registry: r})
+	assert.NoError(t, err)
+	assert.Equal(t, hexMustDecode("b70a27721f9b0500"), b)
+
+	var out time.Time
+	err = UnmarshalWithOptions(b, &out, DecoderOptions{Registry: r})
+	assert.NoError(t, err)
+	assert.Equal(t, in, out)
+
+	_, err = MarshalWithOptions(time.Unix(-1, 0), EncoderOptions{Registry: r})
+	assert.Error(t, err)
+
+	// the largest time in u64 microseconds
+	max := time.Unix(math.MaxUint64/1000000, math.MaxUint64%1000000*1000).UTC()
+	b, err = MarshalWithOptions(max, EncoderOptions{Registry: r})
+	assert.NoError(t, err)
+	assert.Equal(t, hexMustDecode("ffffffffffffffff"), b)
+	err = UnmarshalWithOptions(b, &out, DecoderOptions{Registry: r})
+	assert.NoError(t, err)
+	assert.Equal(t, max, out)
+
+	_, err = MarshalWithOptions(max.Add(time.Microsecond), EncoderOptions{Registry: r})
+	assert.Error(t, err)
+	_, err = MarshalWithOptions(time.Unix(math.MaxInt64/1000, 0), EncoderOptions{Registry: r})
+	assert.Error(t, err)
+
+	// a time inside a struct
+	type Event struct {
+		At  time.Time
+		Seq uint16
+	}
+	b, err = MarshalWithOptions(Event{At: in, Seq: 1}, EncoderOptions{Registry: r})
+	assert.NoError(t, err)
+	assert.Equal(t, hexMustDecode("b70a27721f9b0500 0100"), b)
+	var ev Event
+	err = UnmarshalWithOptions(b, &ev, DecoderOptions{Registry: r})
+	assert.NoError(t, err)
+	assert.Equal(t, Event{At: in, Seq: 1}, ev)
+}
+
+func TestRegisterCodecShouldPanic(t *testing.T) {
+	assert.Panics(t, func() {
+		NewRegistry().RegisterCodec(nil, nil, nil)
+	})
+	assert.Panics(t, func() {
+		NewRegistry().RegisterCodec(reflect.TypeOf(0), nil, nil)
+	})
+	assert.Panics(t, func() {
+		NewRegistry().RegisterBigIntCodec(100)
+	})
+}
+
+func TestDecodeTagged(t *testing.T) {
+	type Coin struct {
+		Value uint64
+	}
+	type Balance struct {
+		Coin Coin
+	}
+	RegisterTaggedType("0x1::Libra::Libra<0x1::Coin1::Coin1>", Coin{})
+	RegisterTaggedType("0x1::LibraAccount::Balance < 0x1::Coin1::Coin1 >", &Balance{})
+
+	v, err := DecodeTagged("0x1::Libra::Libra< 0x1::Coin1::Coin1 >", hexMustDecode("6400000000000000"))
+	assert.NoError(t, err)
+	assert.Equal(t, Coin{Value: 100}, v)
+
+	v, err = DecodeTagged("0x1::LibraAccount::Balance<0x1::Coin1::Coin1>", hexMustDecode("6400000000000000"))
+	assert.NoError(t, err)
+	assert.Equal(t, &Balance{Coin: Coin{Value: 100}}, v)
+
+	_, err = DecodeTagged("0x1::Libra::Libra<0x1::Coin1::Coin1>", hexMustDecode("64"))
+	assert.Error(t, err)
+	_, err = DecodeTagged("0x1::Libra::Libra", nil)
+	assert.EqualError(t, err, `tag "0x1::Libra::Libra" is not registered`)
+	assert.Panics(t, func() {
+		RegisterTaggedType("0x1::Libra::Libra", nil)
+	})
+}
@@ -0,0 +1,104 @@
+package lcs
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// maxSeqLen is the maximum length of a sequence, which is a ULEB128 integer of 28 bits.
+const maxSeqLen = 1<<28 - 1
+
+// SeqEncoder encodes a sequence one element at a time, so that huge sequences can be
+// encoded without holding all elements in memory. It is returned by Encoder.BeginSeq.
+type SeqEncoder struct {
+	e        *Encoder
+	n, count int
+	elemType reflect.Type
+}
+
+// BeginSeq writes the length n of a sequence, and returns a SeqEncoder which encodes
+// exactly n elements. The encoded bytes are the same as encoding a slice of the elements.
+//
+// The Encoder must not be used until the sequence is ended with SeqEncoder.End.
+func (e *Encoder) BeginSeq(n int) (*SeqEncoder, error) {
+	if n < 0 || n > maxSeqLen {
+		return nil, fmt.Errorf("sequence length %d out of range", n)
+	}
+	if _, err := writeVarUint(e.w, uint64(n)); err != nil {
+		return nil, err
+	}
+	return &SeqEncoder{e: e, n: n}, nil
+}
+
+// Encode encodes the next element of the sequence. All elements should have the same type.
+//
+// The encoded elements are buffered, and may not be written until End is called.
+func (s *SeqEncoder) Encode(v interface{}) error {
+	if s.count >= s.n {
+		return fmt.Errorf("sequence has more elements than its length %d", s.n)
+	}
+	t := reflect.TypeOf(v)
+	if s.elemType == nil {
+		if err := checkBareVariant(t); err != nil {
+			return err
+		}
+		s.elemType = t
+	} else if t != s.elemType {
+		return fmt.Errorf("sequence element type %s differs from %s", t, s.elemType)
+	}
+	if err := s.e.encode(reflect.Indirect(reflect.ValueOf(v)), nil, nil); err != nil {
+		return err
+	}
+	s.count++
+	return nil
+}
+
+// End ends the sequence and flushes the encoded elements. It returns an error if fewer
+// elements than the length were encoded.
+func (s *SeqEncoder) End() error {
+	if s.count != s.n {
+		return fmt.Errorf("sequence has %d elements, less than its length %d", s.count, s.n)
+	}
+	return s.e.flush()
+}
+
+// SeqDecoder decodes a sequence one element at a time, so that huge sequences can be
+// decoded without holding all elements in memory. It is returned by Decoder.Seq.
+type SeqDecoder struct {
+	d        *Decoder
+	n, count int
+}
+
+// Seq reads the length of a sequence, and returns a SeqDecoder which decodes its elements.
+//
+// The Decoder must not be used until all elements are decoded.
+func (d *Decoder) Seq() (*SeqDecoder, error) {
+	l, err := readVarUint(d.r, 28)
+	if err != nil {
+		return nil, err
+	}
+	return &SeqDecoder{d: d, n: int(l)}, nil
+}
+
+// Len returns the length of the sequence.
+func (s *SeqDecoder) Len() int {
+	return s.n
+}
+
+// More returns whether there are elements left to decode.
+func (s *SeqDecoder) More() bool {
+	return s.count < s.n
+}
+
+// Decode decodes the next element of the sequence into v.
+func (s *SeqDecoder) Decode(v interface{}) error {
+	if !s.More() {
+		return errors.New("no more elements in sequence")
+	}
+	if err := s.d.Decode(v); err != nil {
+		return err
+	}
+	s.count++
+	return nil
+}
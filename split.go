@@ -0,0 +1,45 @@
+package lcs
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"reflect"
+)
+
+// SplitFunc returns a bufio.SplitFunc which splits the input into encoded values of type t,
+// for use with bufio.Scanner. See SplitFuncWithOptions.
+func SplitFunc(t reflect.Type) bufio.SplitFunc {
+	return SplitFuncWithOptions(t, DecoderOptions{})
+}
+
+// SplitFuncWithOptions returns a bufio.SplitFunc which splits the input into encoded values
+// of type t, with the registry in opts. Each token is a complete encoded value, which can be
+// decoded with Unmarshal.
+//
+// The size of the next value is computed by walking its lengths, optional presence bytes
+// and enum discriminants over the buffered data, without decoding it. If the buffered data
+// ends before the value, more data is requested. Scanner.Buffer should be set if values may
+// be larger than bufio.MaxScanTokenSize.
+func SplitFuncWithOptions(t reflect.Type, opts DecoderOptions) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		w := newWalker(data, opts, false, nil)
+		err = w.walk(t, "", nil, nil, 0)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if !atEOF {
+				return 0, nil, nil
+			}
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		if w.sr.off == 0 {
+			return 0, nil, errors.New("cannot split values of zero size")
+		}
+		return w.sr.off, data[:w.sr.off], nil
+	}
+}
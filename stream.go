@@ -0,0 +1,44 @@
+package lcs
+
+import (
+	"fmt"
+	"io"
+)
+
+// EncodeBytesFrom encodes n bytes read from r as a byte slice, i.e. the ULEB128 length n
+// followed by the bytes. The bytes are copied through without buffering them all, so that
+// large payloads do not need to be held in memory.
+//
+// It returns an error if r has fewer than n bytes.
+func (e *Encoder) EncodeBytesFrom(r io.Reader, n int64) error {
+	if n < 0 || n > maxSeqLen {
+		return fmt.Errorf("byte slice length %d out of range", n)
+	}
+	if _, err := writeVarUint(e.w, uint64(n)); err != nil {
+		return err
+	}
+	if copied, err := io.CopyN(e.w, r, n); err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("read %d bytes, less than length %d", copied, n)
+		}
+		return err
+	}
+	return e.flush()
+}
+
+// DecodeBytesTo decodes a byte slice, and writes its bytes to w without buffering them all,
+// so that large payloads do not need to be held in memory. It returns the number of bytes
+// written.
+//
+// It returns io.ErrUnexpectedEOF if the input ends before the declared length.
+func (d *Decoder) DecodeBytesTo(w io.Writer) (int64, error) {
+	l, err := readVarUint(d.r, 28)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.CopyN(w, d.r, int64(l))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
@@ -1,7 +1,12 @@
 package lcs
 
 import (
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 func parseTag(tag string) map[string]string {
@@ -19,3 +24,224 @@ func parseTag(tag string) map[string]string {
 	}
 	return m
 }
+
+// intWidthTags are the tags that set the encoded width of an integer field.
+var intWidthTags = map[string]struct {
+	bits   int
+	signed bool
+}{
+	"u8":  {8, false},
+	"u16": {16, false},
+	"u32": {32, false},
+	"u64": {64, false},
+	"i8":  {8, true},
+	"i16": {16, true},
+	"i32": {32, true},
+	"i64": {64, true},
+}
+
+// tagScopes are the prefixes of tag options which apply to the elements of slices and
+// arrays, and to the keys and values of maps, e.g. "elem.len=32" or "value.enum=payload".
+// Scopes can be nested, e.g. "elem.elem.optional".
+var tagScopes = []string{"elem", "key", "value"}
+
+// fieldTag is a parsed lcs struct field tag.
+//
+// A nil *fieldTag has no options.
+type fieldTag struct {
+	// owner is the struct type which declares the field. Enum names are looked up in it.
+	owner reflect.Type
+
+	optional bool
+	hasLen   bool
+	fixedLen int
+	enum     string
+	uleb128  bool
+	width    string
+	isSet    bool
+	isMap    bool
+
+	elem, key, value *fieldTag
+
+	// unknown are the unknown options of the tag, including their scopes. They are ignored
+	// when encoding and decoding, and reported by Check.
+	unknown []string
+}
+
+// newFieldTag parses the lcs tag of a field declared in the owner struct type.
+func newFieldTag(owner reflect.Type, tag string) (*fieldTag, error) {
+	if tag == "" {
+		return nil, nil
+	}
+	m := parseTag(tag)
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	root := &fieldTag{owner: owner}
+	for _, name := range names {
+		t, option := root, name
+		for {
+			scope := strings.SplitN(option, ".", 2)
+			if len(scope) < 2 || !isTagScope(scope[0]) {
+				break
+			}
+			t, option = t.scope(scope[0], true), scope[1]
+		}
+		known, err := t.setOption(option, m[name])
+		if err != nil {
+			return nil, err
+		}
+		if !known && name != "" {
+			root.unknown = append(root.unknown, name)
+		}
+	}
+	return root, nil
+}
+
+func isTagScope(name string) bool {
+	for _, s := range tagScopes {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// setOption sets an option of the tag, and returns whether the option is known.
+func (t *fieldTag) setOption(option, value string) (known bool, err error) {
+	switch option {
+	case "optional":
+		t.optional = true
+	case "len":
+		t.hasLen = true
+		if t.fixedLen, err = strconv.Atoi(value); err != nil {
+			return true, errors.New("tag len parse error: " + err.Error())
+		}
+	case "enum":
+		t.enum = value
+	case "uleb128":
+		if t.width != "" {
+			return true, errors.New("conflicting integer width tags: " + t.width + ", " + option)
+		}
+		t.uleb128 = true
+	case "set":
+		t.isSet = true
+	case "map":
+		t.isMap = true
+	default:
+		if _, ok := intWidthTags[option]; !ok {
+			return false, nil
+		}
+		if t.width != "" || t.uleb128 {
+			prev := t.width
+			if t.uleb128 {
+				prev = "uleb128"
+			}
+			return true, errors.New("conflicting integer width tags: " + prev + ", " + option)
+		}
+		t.width = option
+	}
+	return true, nil
+}
+
+// scope returns the options of the given scope, or nil if there is none. If create is true,
+// the scope is created when missing.
+func (t *fieldTag) scope(name string, create bool) *fieldTag {
+	if t == nil {
+		return nil
+	}
+	var p **fieldTag
+	switch name {
+	case "elem":
+		p = &t.elem
+	case "key":
+		p = &t.key
+	case "value":
+		p = &t.value
+	}
+	if *p == nil && create {
+		*p = &fieldTag{owner: t.owner}
+	}
+	return *p
+}
+
+// withoutOptional returns a copy of t with optional cleared, for use after the presence
+// byte is handled.
+func (t *fieldTag) withoutOptional() *fieldTag {
+	t1 := *t
+	t1.optional = false
+	return &t1
+}
+
+func (t *fieldTag) isOptional(k reflect.Kind) bool {
+	return t != nil && t.optional &&
+		(k == reflect.Ptr || k == reflect.Slice || k == reflect.Map || k == reflect.Interface)
+}
+
+// lenOf returns the fixed length set by the len option, or 0 if there is none.
+func (t *fieldTag) lenOf() int {
+	if t == nil || !t.hasLen {
+		return 0
+	}
+	return t.fixedLen
+}
+
+// structField is an encoded field of a struct type.
+type structField struct {
+	index int
+	tag   *fieldTag
+}
+
+// structFieldsCache caches the encoded fields of struct types: map[reflect.Type][]structField.
+var structFieldsCache sync.Map
+
+// structFields returns the encoded fields of struct type rt, i.e. exported fields not tagged
+// with "-", together with their parsed tags.
+func structFields(rt reflect.Type) ([]structField, error) {
+	if fields, ok := structFieldsCache.Load(rt); ok {
+		return fields.([]structField), nil
+	}
+	var fields []structField
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" || f.Tag.Get(lcsTagName) == "-" {
+			continue
+		}
+		tag, err := newFieldTag(rt, f.Tag.Get(lcsTagName))
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, structField{index: i, tag: tag})
+	}
+	structFieldsCache.Store(rt, fields)
+	return fields, nil
+}
+
+// isSetMap returns whether t is a map with empty struct values, i.e. map[K]struct{}, which
+// is encoded as a set of keys.
+func isSetMap(t reflect.Type) bool {
+	return t.Kind() == reflect.Map && t.Elem().Kind() == reflect.Struct && t.Elem().NumField() == 0
+}
+
+// mapEntryFields returns the indexes of the key and value fields of a map entry struct,
+// used by slices with the map tag. The entry struct should have exactly two encoded fields.
+func mapEntryFields(t reflect.Type) (key, value int, err error) {
+	if t.Kind() != reflect.Struct {
+		return 0, 0, errors.New("map tag requires slice of struct, got slice of " + t.Kind().String())
+	}
+	var fields []int
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Tag.Get(lcsTagName) == "-" {
+			continue
+		}
+		fields = append(fields, i)
+	}
+	if len(fields) != 2 {
+		return 0, 0, errors.New("map entry " + t.String() + " should have exactly 2 fields")
+	}
+	return fields[0], fields[1], nil
+}
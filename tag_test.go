@@ -1,6 +1,7 @@
 package lcs
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -15,3 +16,85 @@ func TestParseTag(t *testing.T) {
 		"len":    "16",
 	})
 }
+
+func TestNewFieldTag(t *testing.T) {
+	tag, err := newFieldTag(nil, "optional,elem.len=32,elem.key.enum=test,value.u8")
+	assert.NoError(t, err)
+	assert.Equal(t, &fieldTag{
+		optional: true,
+		elem: &fieldTag{
+			hasLen:   true,
+			fixedLen: 32,
+			key:      &fieldTag{enum: "test"},
+		},
+		value: &fieldTag{width: "u8"},
+	}, tag)
+
+	_, err = newFieldTag(nil, "elem.len=x")
+	assert.Error(t, err)
+}
+
+type checkTestEnum interface{}
+
+type checkTestList []checkTestList
+
+type checkTestStatus uint8
+
+type checkTestBad struct {
+	Count    int
+	Ratio    float64
+	Callback func()
+	Ch       chan int
+	Any      checkTestEnum
+	Payload  checkTestEnum   `lcs:"enum=payload"`
+	Hash     []byte          `lcs:"len=-1"`
+	Key      [32]byte        `lcs:"len=16"`
+	Name     string          `lcs:"len=abc"`
+	Amount   uint64          `lcs:"optinal"`
+	Flags    uint32          `lcs:"uleb128,elem.len=2"`
+	Varint   uint64          `lcs:"uleb128,u8"`
+	Status   checkTestStatus `lcs:"uleb128"`
+	Level    checkTestStatus `lcs:"u16"`
+	Items    []*checkTestBad `lcs:"elem.optional,value.u8"`
+	Nested   map[string][]int
+	List     checkTestList
+	skipped  float64
+	Skipped  float64 `lcs:"-"`
+}
+
+func TestCheck(t *testing.T) {
+	RegisterCEnum((*checkTestStatus)(nil), 3)
+	for _, v := range []interface{}{
+		OptionSlice{},
+		walkTestAccount{},
+		hookTestBatch{},
+		(*walkTestAccount)(nil),
+	} {
+		assert.NoError(t, Check(reflect.TypeOf(v)), "%T", v)
+	}
+	assert.NotPanics(t, func() { MustCheck(reflect.TypeOf(walkTestAccount{})) })
+
+	err := Check(reflect.TypeOf(checkTestBad{}))
+	if assert.IsType(t, &CheckError{}, err) {
+		assert.Equal(t, []string{
+			`Count: not supported kind: int, missing width tag such as lcs:"i32" or lcs:"i64"`,
+			`Ratio: not supported kind: float64`,
+			`Callback: not supported kind: func`,
+			`Ch: not supported kind: chan`,
+			`Any: interface lcs.checkTestEnum is not a registered enum, and has no enum tag`,
+			`Payload: struct lcs.checkTestBad does not implement EnumTypeUser`,
+			`Hash: len should be positive, got -1`,
+			`Key: len 16 differs from the array length 32`,
+			`Name: tag len parse error: strconv.Atoi: parsing "abc": invalid syntax`,
+			`Amount: unknown tag option "optinal"`,
+			`Flags: elem tag options on uint32, which is not a slice or array`,
+			`Varint: conflicting integer width tags: u8, uleb128`,
+			`Status: uleb128 tag on C-style enum lcs.checkTestStatus, which is encoded as a discriminant`,
+			`Level: u16 tag on C-style enum lcs.checkTestStatus, which is encoded as a discriminant`,
+			`Items: key or value tag options on []*lcs.checkTestBad, which is not a map`,
+			`Nested[][]: not supported kind: int, missing width tag such as lcs:"i32" or lcs:"i64"`,
+		}, err.(*CheckError).Problems)
+	}
+	assert.Panics(t, func() { MustCheck(reflect.TypeOf(checkTestBad{})) })
+	assert.EqualError(t, Check(nil), "nil type")
+}
@@ -0,0 +1,65 @@
+package lcs
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+var regTaggedTypes map[string]reflect.Type
+
+// normalizeTag removes all whitespace in tag, so that "0x1::M::S<u8, u64>" and
+// "0x1::M::S<u8,u64>" are the same tag.
+func normalizeTag(tag string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, tag)
+}
+
+// RegisterTaggedType registers the type of template for tag, such as a Move struct tag like
+// "0x1::Coin::Coin<0x1::XUS::XUS>", so that payloads labeled with the tag can be decoded by
+// DecodeTagged. Whitespace in tags is ignored. If the tag was registered, it will be
+// overwriten.
+//
+// This function panics on errors.
+func RegisterTaggedType(tag string, template interface{}) {
+	t := reflect.TypeOf(template)
+	if t == nil {
+		panic("template of tag " + tag + " should not be nil")
+	}
+	if regTaggedTypes == nil {
+		regTaggedTypes = make(map[string]reflect.Type)
+	}
+	regTaggedTypes[normalizeTag(tag)] = t
+}
+
+// TaggedType returns the type registered for tag.
+func TaggedType(tag string) (reflect.Type, bool) {
+	t, ok := regTaggedTypes[normalizeTag(tag)]
+	return t, ok
+}
+
+// DecodeTagged decodes data as a value of the type registered for tag. See
+// DecodeTaggedWithOptions.
+func DecodeTagged(tag string, data []byte) (interface{}, error) {
+	return DecodeTaggedWithOptions(tag, data, DecoderOptions{})
+}
+
+// DecodeTaggedWithOptions decodes data as a value of the type registered for tag, with the
+// given options. The returned value has the type of the registered template, e.g. a struct
+// for a struct template, or a pointer to it for a pointer template.
+func DecodeTaggedWithOptions(tag string, data []byte, opts DecoderOptions) (interface{}, error) {
+	t, ok := TaggedType(tag)
+	if !ok {
+		return nil, fmt.Errorf("tag %q is not registered", tag)
+	}
+	rv := reflect.New(t)
+	if err := UnmarshalWithOptions(data, rv.Interface(), opts); err != nil {
+		return nil, err
+	}
+	return rv.Elem().Interface(), nil
+}
@@ -1,5 +1,10 @@
 package lcs
 
+import (
+	"errors"
+	"reflect"
+)
+
 const (
 	lcsTagName = "lcs"
 
@@ -12,6 +17,10 @@ const (
 	// It is set to 100MB by default.
 	maxByteSliceSize = 100 * 1024 * 1024
 
+	// bulkChunkSize is the size of the chunks in which slices of integers or booleans grow,
+	// when they are decoded from a stream.
+	bulkChunkSize = 64 * 1024
+
 	// sliceAndMapInitSize is the initial allocation size for non-byte slices.
 	//
 	// When decoding a non-byte slice, we will allocate an initial space, and then append to it.
@@ -20,6 +29,16 @@ const (
 
 type EnumKeyType = uint64
 
+// errMissingWidthTag is returned for int, uint and uintptr values, whose size depends on
+// the platform. Such values can only be encoded as struct fields with a width tag.
+func errMissingWidthTag(k reflect.Kind) error {
+	suggest := `lcs:"u32"` + " or " + `lcs:"u64"`
+	if k == reflect.Int {
+		suggest = `lcs:"i32"` + " or " + `lcs:"i64"`
+	}
+	return errors.New("not supported kind: " + k.String() + ", missing width tag such as " + suggest)
+}
+
 // EnumVariant is a definition of a variant of enum type.
 type EnumVariant struct {
 	// Name of the enum type. Different variants of a same enum type should have same name.
@@ -0,0 +1,408 @@
+package lcs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// walkSpan is a part of encoded data visited by a walker: an encoded value, or a length
+// prefix, optional presence byte, enum discriminant or map key of a value.
+type walkSpan struct {
+	// path is the path of the value, such as "Account.Balances[\"XUS\"].Amount". The root
+	// value has an empty path.
+	path string
+	typ  reflect.Type
+	// label is empty for values, and "len", "optional", "variant" or "key" for the parts
+	// of a value.
+	label      string
+	start, end int
+	// depth is the nesting depth of the value, which is 0 for the root value.
+	depth int
+	// leaf is whether the value is decoded as a whole, without visiting its parts.
+	leaf bool
+	// seq orders spans as they start: a value before its parts, and parts in order.
+	seq int
+	// value is the decoded value of labeled spans, and of leaves if the walker decodes
+	// values. It is invalid otherwise.
+	value reflect.Value
+	// decl is the declaration of values, and nil for labeled spans.
+	decl *walkDecl
+}
+
+// walkDecl is the declaration of a value: its declared type, tag and enum variants, with
+// which the value can be decoded or encoded alone.
+type walkDecl struct {
+	typ          reflect.Type
+	tag          *fieldTag
+	enumVariants map[EnumKeyType]reflect.Type
+}
+
+// walker walks in-memory encoded data by type, without decoding it into Go values. Only
+// leaves, such as integers and strings, are decoded, and only when values are requested.
+type walker struct {
+	d      *Decoder
+	sr     *sliceReader
+	values bool
+	seq    int
+	// visit is called with every span. Spans of values are visited after their parts.
+	visit func(s *walkSpan) error
+}
+
+func newWalker(data []byte, opts DecoderOptions, values bool, visit func(s *walkSpan) error) *walker {
+	sr := &sliceReader{data: data}
+	return &walker{
+		d:      newDecoder(sr, opts),
+		sr:     sr,
+		values: values,
+		visit:  visit,
+	}
+}
+
+// nextSeq returns the seq of the next span which starts.
+func (w *walker) nextSeq() int {
+	w.seq++
+	return w.seq
+}
+
+// sortSpans sorts spans in the order they start.
+func sortSpans(spans []*walkSpan) {
+	sort.Slice(spans, func(i, j int) bool { return spans[i].seq < spans[j].seq })
+}
+
+func (w *walker) emit(s *walkSpan) error {
+	if w.visit == nil {
+		return nil
+	}
+	return w.visit(s)
+}
+
+// emitLabel visits the part of the value at path from start to the current offset.
+func (w *walker) emitLabel(path string, t reflect.Type, label string, start, depth int, value interface{}) error {
+	return w.emit(&walkSpan{
+		path:  path,
+		typ:   t,
+		label: label,
+		seq:   w.nextSeq(),
+		start: start,
+		end:   w.sr.off,
+		depth: depth,
+		value: reflect.ValueOf(value),
+	})
+}
+
+// walk walks the encoded value of type t at path, the same way as Decoder.decode decodes it.
+// The span of the value includes its optional presence byte and enum discriminant.
+func (w *walker) walk(t reflect.Type, path string, enumVariants map[EnumKeyType]reflect.Type, tag *fieldTag, depth int) (err error) {
+	s := walkSpan{path: path, start: w.sr.off, depth: depth, seq: w.nextSeq()}
+	if w.visit != nil {
+		s.decl = &walkDecl{typ: t, tag: tag, enumVariants: enumVariants}
+	}
+	if tag.isOptional(t.Kind()) {
+		var present bool
+		if present, err = w.d.readBool(); err != nil {
+			return
+		}
+		if err = w.emitLabel(path, t, "optional", s.start, depth, present); err != nil {
+			return
+		}
+		if !present {
+			s.typ, s.end, s.leaf, s.value = t, w.sr.off, true, reflect.Zero(t)
+			return w.emit(&s)
+		}
+		tag = tag.withoutOptional()
+	}
+
+	leaf := false
+	for !leaf {
+		if w.hasCodec(t) {
+			leaf = true
+			break
+		}
+		if tag != nil && tag.enum != "" {
+			if enumVariants, err = w.d.enumVariants(tag); err != nil {
+				return
+			}
+		}
+		if _, ok := cEnumGetSize(t); ok || tag != nil && (tag.uleb128 || tag.width != "") {
+			leaf = true
+			break
+		}
+		if tag != nil && (tag.isSet || tag.isMap) {
+			break
+		}
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+			continue
+		}
+		if t.Kind() != reflect.Interface {
+			leaf = w.isLeaf(t, tag)
+			break
+		}
+		variantStart := w.sr.off
+		var typeVal uint64
+		if typeVal, err = readVarUint(w.sr, 28); err != nil {
+			return
+		}
+		tpl, ok := enumGetTypeByIdx(t, typeVal)
+		if !ok {
+			if tpl, ok = enumVariants[typeVal]; !ok {
+				return fmt.Errorf("enum variant value %d unknown for interface: %s", typeVal, t)
+			}
+		}
+		if tpl.Kind() == reflect.Ptr {
+			tpl = tpl.Elem()
+		}
+		if err = w.emitLabel(path, tpl, "variant", variantStart, depth, typeVal); err != nil {
+			return
+		}
+		// the variant is decoded through a new pointer, without enum variants and tag
+		t, enumVariants, tag = reflect.PtrTo(tpl), nil, nil
+	}
+	if leaf {
+		return w.walkLeaf(t, enumVariants, tag, s)
+	}
+
+	switch {
+	case tag != nil && tag.isSet:
+		if t.Kind() != reflect.Slice {
+			return errors.New("set tag requires slice, got " + t.Kind().String())
+		}
+		err = w.walkSeq(t, path, enumVariants, tag.scope("elem", false), 0, depth, true)
+	case tag != nil && tag.isMap:
+		if t.Kind() != reflect.Slice {
+			return errors.New("map tag requires slice, got " + t.Kind().String())
+		}
+		err = w.walkEntries(t, path, depth)
+	case t.Kind() == reflect.Slice:
+		err = w.walkSeq(t, path, enumVariants, tag.scope("elem", false), tag.lenOf(), depth, false)
+	case t.Kind() == reflect.Array:
+		err = w.walkSeq(t, path, enumVariants, tag.scope("elem", false), t.Len(), depth, false)
+	case t.Kind() == reflect.Struct:
+		err = w.walkStruct(t, path, depth)
+	case t.Kind() == reflect.Map:
+		err = w.walkMap(t, path, tag, depth)
+	default:
+		err = errors.New("not supported kind: " + t.Kind().String())
+	}
+	s.typ, s.end = t, w.sr.off
+	if err != nil {
+		// the incomplete value is visited too, so that its parts before the error have it
+		w.emit(&s)
+		return
+	}
+	return w.emit(&s)
+}
+
+func (w *walker) hasCodec(t reflect.Type) bool {
+	if _, ok := w.d.opts.Registry.codec(t); ok {
+		return true
+	}
+	_, ok := w.d.opts.Registry.codec(reflect.PtrTo(t))
+	return ok
+}
+
+// isLeaf returns whether values of type t are decoded as a whole.
+func (w *walker) isLeaf(t reflect.Type, tag *fieldTag) bool {
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		return isBulkElem(t.Elem(), tag.scope("elem", false), w.d.opts.Registry)
+	case reflect.Struct, reflect.Map:
+		return false
+	}
+	// including unsupported kinds, for which decoding reports the error
+	return true
+}
+
+// walkLeaf decodes a leaf, or skips it if values are not requested and it has a length. The
+// span s of the leaf is started, before its optional presence byte and enum discriminant.
+func (w *walker) walkLeaf(t reflect.Type, enumVariants map[EnumKeyType]reflect.Type, tag *fieldTag, s walkSpan) (err error) {
+	s.typ, s.leaf = t, true
+	lenStart := w.sr.off
+	hasLen := !w.hasCodec(t) && tag.lenOf() == 0 &&
+		(t.Kind() == reflect.String || t.Kind() == reflect.Slice) &&
+		(tag == nil || !tag.uleb128 && tag.width == "")
+	if hasLen {
+		var l uint64
+		if l, err = readVarUint(w.sr, 28); err != nil {
+			return
+		}
+		if err = w.emitLabel(s.path, t, "len", lenStart, s.depth, int(l)); err != nil {
+			return
+		}
+		if !w.values && (t.Kind() == reflect.String || t.Elem().Kind() != reflect.Bool) {
+			// the bytes do not need to be validated, unlike booleans
+			size := 1
+			if t.Kind() == reflect.Slice {
+				size = int(t.Elem().Size())
+			}
+			if (t.Kind() == reflect.String || t == reflect.TypeOf([]byte{})) && l > maxByteSliceSize {
+				// like the decoder, which rejects them before allocating
+				return errors.New("byte slice longer than 100MB not supported")
+			}
+			if int(l) > (len(w.sr.data)-w.sr.off)/size {
+				w.sr.off = len(w.sr.data)
+				return io.ErrUnexpectedEOF
+			}
+			if _, err = w.sr.next(int(l) * size); err != nil {
+				return
+			}
+			s.end = w.sr.off
+			return w.emit(&s)
+		}
+		w.sr.off = lenStart
+	}
+	v := reflect.New(t).Elem()
+	if err = w.d.decode(v, enumVariants, tag); err != nil {
+		return
+	}
+	s.end = w.sr.off
+	if w.values {
+		s.value = v
+	}
+	return w.emit(&s)
+}
+
+// walkSeq walks the elements of a slice or array. If fixedLen is 0, the length is read
+// first. If set is true, the elements should be in canonical order without duplicates.
+func (w *walker) walkSeq(t reflect.Type, path string, enumVariants map[EnumKeyType]reflect.Type, elemTag *fieldTag, fixedLen, depth int, set bool) (err error) {
+	l := fixedLen
+	if l == 0 && t.Kind() == reflect.Slice {
+		start := w.sr.off
+		var l1 uint64
+		if l1, err = readVarUint(w.sr, 28); err != nil {
+			return
+		}
+		l = int(l1)
+		if err = w.emitLabel(path, t, "len", start, depth, l); err != nil {
+			return
+		}
+	}
+	var prev []byte
+	for i := 0; i < l; i++ {
+		start := w.sr.off
+		if err = w.walk(t.Elem(), path+"["+strconv.Itoa(i)+"]", enumVariants, elemTag, depth+1); err != nil {
+			return
+		}
+		b := w.sr.data[start:w.sr.off]
+		if set && i > 0 && bytes.Compare(prev, b) >= 0 {
+			return errors.New("set elements not in canonical order or duplicated")
+		}
+		prev = b
+	}
+	return
+}
+
+func (w *walker) walkStruct(t reflect.Type, path string, depth int) error {
+	fields, err := structFields(t)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		name := t.Field(f.index).Name
+		if path != "" {
+			name = path + "." + name
+		}
+		if err = w.walk(t.Field(f.index).Type, name, nil, f.tag, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkMap walks the entries of a map. Keys are always decoded, since they are part of the
+// paths of values.
+func (w *walker) walkMap(t reflect.Type, path string, tag *fieldTag, depth int) (err error) {
+	l, err := w.walkLen(t, path, depth)
+	if err != nil {
+		return
+	}
+	keyTag, valueTag := tag.scope("key", false), tag.scope("value", false)
+	isSet := isSetMap(t)
+	var prev []byte
+	for i := 0; i < l; i++ {
+		var kb []byte
+		if kb, err = w.walkEntry(path, t.Key(), keyTag, t.Elem(), valueTag, depth); err != nil {
+			return
+		}
+		if isSet && i > 0 && bytes.Compare(prev, kb) >= 0 {
+			return errors.New("set elements not in canonical order or duplicated")
+		}
+		prev = kb
+	}
+	return
+}
+
+// walkEntries walks a slice of key-value structs with the map tag like a map, so that the
+// paths of values have their keys rather than their indexes. Like decoding, the order of
+// the keys is not checked.
+func (w *walker) walkEntries(t reflect.Type, path string, depth int) (err error) {
+	rt := t.Elem()
+	ki, vi, err := mapEntryFields(rt)
+	if err != nil {
+		return
+	}
+	keyTag, err := newFieldTag(rt, rt.Field(ki).Tag.Get(lcsTagName))
+	if err != nil {
+		return
+	}
+	valueTag, err := newFieldTag(rt, rt.Field(vi).Tag.Get(lcsTagName))
+	if err != nil {
+		return
+	}
+	l, err := w.walkLen(t, path, depth)
+	if err != nil {
+		return
+	}
+	for i := 0; i < l; i++ {
+		if _, err = w.walkEntry(path, rt.Field(ki).Type, keyTag, rt.Field(vi).Type, valueTag, depth); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// walkLen reads the length of a map, and visits it.
+func (w *walker) walkLen(t reflect.Type, path string, depth int) (int, error) {
+	start := w.sr.off
+	l, err := readVarUint(w.sr, 28)
+	if err != nil {
+		return 0, err
+	}
+	return int(l), w.emitLabel(path, t, "len", start, depth, int(l))
+}
+
+// walkEntry walks an entry of a map: the key, which is decoded and visited as the "key" part
+// of the entry, and the value at the path of the entry. It returns the encoded key.
+func (w *walker) walkEntry(path string, kt reflect.Type, keyTag *fieldTag, vt reflect.Type, valueTag *fieldTag, depth int) ([]byte, error) {
+	start := w.sr.off
+	k := reflect.New(kt).Elem()
+	if err := w.d.decode(k, nil, keyTag); err != nil {
+		return nil, err
+	}
+	kb := w.sr.data[start:w.sr.off]
+	entry := path + "[" + formatKey(k, kb) + "]"
+	if err := w.emitLabel(entry, kt, "key", start, depth+1, k.Interface()); err != nil {
+		return nil, err
+	}
+	return kb, w.walk(vt, entry, nil, valueTag, depth+1)
+}
+
+// formatKey formats a map key in a path: strings are quoted, booleans and integers are
+// formatted as is, and other keys are formatted as their encoded bytes in hex.
+func formatKey(k reflect.Value, encoded []byte) string {
+	switch k.Kind() {
+	case reflect.String:
+		return strconv.Quote(k.String())
+	case reflect.Bool,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprint(k.Interface())
+	}
+	return "0x" + hex.EncodeToString(encoded)
+}
@@ -0,0 +1,334 @@
+package lcs
+
+import (
+	"bufio"
+	"bytes"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type walkTestEvent interface {
+	isWalkTestEvent()
+}
+
+type walkTestSent struct {
+	Amount uint64
+}
+type walkTestMemo string
+
+func (*walkTestSent) isWalkTestEvent() {}
+func (walkTestMemo) isWalkTestEvent()  {}
+
+func init() {
+	RegisterEnum((*walkTestEvent)(nil),
+		(*walkTestSent)(nil),
+		walkTestMemo(""),
+	)
+}
+
+type walkTestAccount struct {
+	Sequence uint64
+	Balances map[string]uint64
+	Auth     []byte
+	Parent   *walkTestAccount `lcs:"optional"`
+	Events   []walkTestEvent
+}
+
+func walkTestData() (*walkTestAccount, []byte) {
+	v := &walkTestAccount{
+		Sequence: 7,
+		Balances: map[string]uint64{"XUS": 100, "LBR": 5},
+		Auth:     []byte{0xaa, 0xbb},
+		Events: []walkTestEvent{
+			&walkTestSent{Amount: 3},
+			walkTestMemo("hi"),
+		},
+	}
+	return v, hexMustDecode("0700000000000000" +
+		"02 034c4252 0500000000000000 03585553 6400000000000000" +
+		"02 aabb" +
+		"00" +
+		"02 00 0300000000000000 01 026869")
+}
+
+func TestSplitFunc(t *testing.T) {
+	v, data := walkTestData()
+	b, err := Marshal(v)
+	assert.NoError(t, err)
+	assert.Equal(t, data, b)
+
+	var stream []byte
+	for i := 0; i < 3; i++ {
+		stream = append(stream, data...)
+	}
+	s := bufio.NewScanner(iotest.OneByteReader(bytes.NewReader(stream)))
+	s.Split(SplitFunc(reflect.TypeOf(walkTestAccount{})))
+	n := 0
+	for s.Scan() {
+		assert.Equal(t, data, s.Bytes())
+		n++
+	}
+	assert.NoError(t, s.Err())
+	assert.Equal(t, 3, n)
+
+	s = bufio.NewScanner(bytes.NewReader(append(data, data[:10]...)))
+	s.Split(SplitFunc(reflect.TypeOf(walkTestAccount{})))
+	assert.True(t, s.Scan())
+	assert.False(t, s.Scan())
+	assert.EqualError(t, s.Err(), "unexpected EOF")
+
+	s = bufio.NewScanner(bytes.NewReader(hexMustDecode("01 02")))
+	s.Split(SplitFunc(reflect.TypeOf(true)))
+	assert.True(t, s.Scan())
+	assert.False(t, s.Scan())
+	assert.EqualError(t, s.Err(), "unexpected value for bool")
+
+	s = bufio.NewScanner(bytes.NewReader(hexMustDecode("00")))
+	s.Split(SplitFunc(reflect.TypeOf(struct{}{})))
+	assert.False(t, s.Scan())
+	assert.EqualError(t, s.Err(), "cannot split values of zero size")
+}
+
+func TestVerifyCanonical(t *testing.T) {
+	_, data := walkTestData()
+	var v walkTestAccount
+	assert.NoError(t, VerifyCanonical(data, &v))
+
+	unsorted := hexMustDecode("0700000000000000" +
+		"02 03585553 6400000000000000 034c4252 0500000000000000" +
+		"02 aabb 00 00")
+	err := VerifyCanonical(unsorted, &v)
+	assert.EqualError(t, err, `non-canonical encoding at offset 10, in key of Balances["XUS"]`)
+	assert.Equal(t, &CanonicalError{Offset: 10, Path: `Balances["XUS"]`, Label: "key"}, err)
+
+	nonMinimal := hexMustDecode("0700000000000000 00 8200 aabb 00 00")
+	err = VerifyCanonical(nonMinimal, &v)
+	assert.EqualError(t, err, "non-canonical encoding at offset 9, in len of Auth")
+
+	var u uint64
+	err = VerifyCanonical(hexMustDecode("0700000000000000 00"), &u)
+	assert.EqualError(t, err, "unexpected data")
+}
+
+func TestAnnotate(t *testing.T) {
+	_, data := walkTestData()
+	var v walkTestAccount
+	out, err := Annotate(data, &v)
+	assert.NoError(t, err)
+	expected, _ := walkTestData()
+	assert.Equal(t, expected, &v)
+	assert.Equal(t, ""+
+		"offset  bytes             path                       type                  value\n"+
+		"000000                    .                          lcs.walkTestAccount   \n"+
+		"000000  0700000000000000    Sequence                 uint64                7\n"+
+		"000008                      Balances                 map[string]uint64     \n"+
+		"000008  02                    Balances (len)         map[string]uint64     2\n"+
+		"000009  034c4252              Balances[\"LBR\"] (key)  string                \"LBR\"\n"+
+		"00000d  0500000000000000      Balances[\"LBR\"]        uint64                5\n"+
+		"000015  03585553              Balances[\"XUS\"] (key)  string                \"XUS\"\n"+
+		"000019  6400000000000000      Balances[\"XUS\"]        uint64                100\n"+
+		"000021  02aabb              Auth                     []uint8               0xaabb\n"+
+		"000021  02                    Auth (len)             []uint8               2\n"+
+		"000024  00                  Parent                   *lcs.walkTestAccount  <nil>\n"+
+		"000024  00                    Parent (optional)      *lcs.walkTestAccount  false\n"+
+		"000025                      Events                   []lcs.walkTestEvent   \n"+
+		"000025  02                    Events (len)           []lcs.walkTestEvent   2\n"+
+		"000026                        Events[0]              lcs.walkTestSent      \n"+
+		"000026  00                      Events[0] (variant)  lcs.walkTestSent      0\n"+
+		"000027  0300000000000000        Events[0].Amount     uint64                3\n"+
+		"00002f  01026869              Events[1]              lcs.walkTestMemo      \"hi\"\n"+
+		"00002f  01                      Events[1] (variant)  lcs.walkTestMemo      1\n"+
+		"000030  02                      Events[1] (len)      lcs.walkTestMemo      2\n", out)
+
+	out, err = Annotate(data[:30], &v)
+	assert.EqualError(t, err, "unexpected EOF")
+	assert.True(t, strings.HasSuffix(out, ""+
+		"000015  03585553              Balances[\"XUS\"] (key)  string               \"XUS\"\n"+
+		"00001e                    error: unexpected EOF                           \n"), out)
+}
+
+func TestAnnotateStringer(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterBigIntCodec(64)
+	type amount struct {
+		V big.Int
+	}
+	var v amount
+	out, err := AnnotateWithOptions(hexMustDecode("0700000000000000"), &v, DecoderOptions{Registry: r})
+	assert.NoError(t, err)
+	assert.Equal(t, ""+
+		"offset  bytes             path  type        value\n"+
+		"000000                    .     lcs.amount  \n"+
+		"000000  0700000000000000    V   big.Int     7\n", out)
+}
+
+func TestDiff(t *testing.T) {
+	typ := reflect.TypeOf(walkTestAccount{})
+	v, a := walkTestData()
+	v.Sequence = 8
+	delete(v.Balances, "LBR")
+	v.Balances["XUS"] = 99
+	v.Balances["EUR"] = 1
+	v.Parent = &walkTestAccount{}
+	v.Events = []walkTestEvent{walkTestMemo("hi"), walkTestMemo("hi"), walkTestMemo("yo")}
+	b, err := Marshal(v)
+	assert.NoError(t, err)
+
+	diffs, err := Diff(a, b, typ)
+	assert.NoError(t, err)
+	var lines []string
+	for _, d := range diffs {
+		lines = append(lines, d.String())
+	}
+	assert.Equal(t, []string{
+		"changed Sequence at 0x0/0x0: 7 -> 8",
+		`removed Balances["LBR"] at 0xd/-`,
+		`changed Balances["XUS"] at 0x19/0x19: 100 -> 99`,
+		"added Parent at 0x24/0x24",
+		"length changed Events at 0x25/0x31: 2 -> 3",
+		"variant changed Events[0] at 0x26/0x32: 0 -> 1",
+		`added Balances["EUR"] at -/0xd`,
+		"added Events[2] at -/0x3a",
+	}, lines)
+	assert.Equal(t, Difference{Kind: DiffChanged, Path: "Sequence", OffsetA: 0, OffsetB: 0, A: uint64(7), B: uint64(8)}, diffs[0])
+
+	diffs, err = Diff(a, a, typ)
+	assert.NoError(t, err)
+	assert.Empty(t, diffs)
+
+	_, err = Diff(a, b[:11], typ)
+	assert.EqualError(t, err, "second value: unexpected EOF")
+}
+
+func TestDiffOrderedMap(t *testing.T) {
+	type Entry struct {
+		Key   []byte
+		Value uint64
+	}
+	type State struct {
+		R []Entry `lcs:"map"`
+	}
+	a, err := Marshal(State{R: []Entry{{[]byte{1}, 10}, {[]byte{3}, 30}}})
+	assert.NoError(t, err)
+	b, err := Marshal(State{R: []Entry{{[]byte{1}, 10}, {[]byte{2}, 20}, {[]byte{3}, 30}}})
+	assert.NoError(t, err)
+
+	// the entries after the inserted key are matched by key, not by index
+	diffs, err := Diff(a, b, reflect.TypeOf(State{}))
+	assert.NoError(t, err)
+	assert.Equal(t, []Difference{
+		{Kind: DiffLen, Path: "R", OffsetA: 0, OffsetB: 0, A: 2, B: 3},
+		{Kind: DiffAdded, Path: "R[0x0102]", OffsetA: -1, OffsetB: 0xd},
+	}, diffs)
+}
+
+func TestExtract(t *testing.T) {
+	typ := reflect.TypeOf(walkTestAccount{})
+	_, data := walkTestData()
+	cases := []struct {
+		path     string
+		expected interface{}
+	}{
+		{"Sequence", uint64(7)},
+		{`Balances["XUS"]`, uint64(100)},
+		{"Auth", []byte{0xaa, 0xbb}},
+		{"Parent", (*walkTestAccount)(nil)},
+		{"Events[0]", &walkTestSent{Amount: 3}},
+		{"Events[0].Amount", uint64(3)},
+		{"Events[1]", walkTestMemo("hi")},
+	}
+	for _, c := range cases {
+		v, err := Extract(data, typ, c.path)
+		assert.NoError(t, err, c.path)
+		assert.Equal(t, c.expected, v, c.path)
+	}
+	// the values after the extracted value are not read
+	v, err := Extract(data[:8], typ, "Sequence")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(7), v)
+
+	_, err = Extract(data, typ, `Balances["EUR"]`)
+	assert.EqualError(t, err, `path "Balances[\"EUR\"]" not found`)
+}
+
+func TestPatch(t *testing.T) {
+	typ := reflect.TypeOf(walkTestAccount{})
+	v, data := walkTestData()
+
+	patched, err := Patch(data, typ, `Balances["XUS"]`, uint64(99))
+	assert.NoError(t, err)
+	v.Balances["XUS"] = 99
+	expected, err := Marshal(v)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, patched)
+
+	patched, err = Patch(patched, typ, "Auth", []byte{1, 2, 3})
+	assert.NoError(t, err)
+	patched, err = Patch(patched, typ, "Parent", &walkTestAccount{Sequence: 1})
+	assert.NoError(t, err)
+	patched, err = Patch(patched, typ, "Events[1]", walkTestEvent(&walkTestSent{Amount: 4}))
+	assert.NoError(t, err)
+	v.Auth = []byte{1, 2, 3}
+	v.Parent = &walkTestAccount{Sequence: 1}
+	v.Events[1] = &walkTestSent{Amount: 4}
+	expected, err = Marshal(v)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, patched)
+
+	_, err = Patch(data, typ, "Sequence", uint32(1))
+	assert.EqualError(t, err, "cannot patch Sequence of type uint64 with uint32")
+
+	type set struct {
+		S []uint16 `lcs:"set"`
+	}
+	data, err = Marshal(set{S: []uint16{1, 2}})
+	assert.NoError(t, err)
+	_, err = Patch(data, reflect.TypeOf(set{}), "S[0]", uint16(3))
+	assert.EqualError(t, err, "patched data: set elements not in canonical order or duplicated")
+}
+
+func TestExtractBulkElem(t *testing.T) {
+	type bulk struct {
+		Vals []uint64
+		Arr  [3]uint16
+		Opt  []int8 `lcs:"optional"`
+	}
+	typ := reflect.TypeOf(bulk{})
+	v := bulk{Vals: []uint64{1, 2}, Arr: [3]uint16{4, 5, 6}, Opt: []int8{-1, -2}}
+	data, err := Marshal(v)
+	assert.NoError(t, err)
+
+	cases := []struct {
+		path     string
+		expected interface{}
+	}{
+		{"Vals[1]", uint64(2)},
+		{"Arr[2]", uint16(6)},
+		{"Opt[0]", int8(-1)},
+	}
+	for _, c := range cases {
+		x, err := Extract(data, typ, c.path)
+		assert.NoError(t, err, c.path)
+		assert.Equal(t, c.expected, x, c.path)
+	}
+	for _, path := range []string{"Vals[2]", "Arr[-1]", "Arr[01]", "Arr[1].X"} {
+		_, err = Extract(data, typ, path)
+		assert.EqualError(t, err, "path \""+path+"\" not found")
+	}
+
+	patched, err := Patch(data, typ, "Vals[1]", uint64(7))
+	assert.NoError(t, err)
+	patched, err = Patch(patched, typ, "Arr[2]", uint16(8))
+	assert.NoError(t, err)
+	patched, err = Patch(patched, typ, "Opt[1]", int8(9))
+	assert.NoError(t, err)
+	v.Vals[1], v.Arr[2], v.Opt[1] = 7, 8, 9
+	expected, err := Marshal(v)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, patched)
+}